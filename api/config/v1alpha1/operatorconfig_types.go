@@ -0,0 +1,204 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	componentconfig "k8s.io/component-base/config/v1alpha1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+// Built-in defaults used when the configuration file leaves them empty
+const (
+	DefaultImage                      = "dxas90/learn:latest"
+	DefaultReplicas             int32 = 2
+	DefaultMinReplicas          int32 = 1
+	DefaultMaxReplicas          int32 = 5
+	DefaultConcurrentReconciles       = 1
+	DefaultReconcileTimeout           = 2 * time.Minute
+)
+
+//+kubebuilder:object:root=true
+
+// OperatorConfig is the Schema of the configuration file given to the manager with --config
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec holds the metrics and health probe
+	// addresses, the leader election settings and the sync period of the manager
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// WatchNamespaces restricts the operator to the listed namespaces.
+	// All the namespaces are watched when it and WatchNamespaceSelector are empty.
+	// +optional
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// WatchNamespaceSelector restricts the operator to the namespaces matching
+	// the selector, in addition to WatchNamespaces. The operator checks them
+	// every minute and restarts to watch the new set when it changed.
+	// +optional
+	WatchNamespaceSelector *metav1.LabelSelector `json:"watchNamespaceSelector,omitempty"`
+
+	// MaxConcurrentReconciles is the number of objects of each kind, Learn, Status
+	// and Crypto, reconciled in parallel
+	// +optional
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+
+	// ReconcileTimeout bounds a single reconcile, the API calls still running
+	// when it expires are cancelled and the object is requeued
+	// +optional
+	ReconcileTimeout *metav1.Duration `json:"reconcileTimeout,omitempty"`
+
+	// LearnDefaults are applied to the fields a Learn leaves empty
+	// +optional
+	LearnDefaults LearnDefaults `json:"learnDefaults,omitempty"`
+}
+
+// LearnDefaults are the operator wide defaults of the Learn spec
+type LearnDefaults struct {
+	// Image deployed when spec.image is empty
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Replicas used when spec.replicas is empty
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// MinReplicas of the HorizontalPodAutoscaler when spec.autoscaling.minReplicas is empty
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas of the HorizontalPodAutoscaler when spec.autoscaling.maxReplicas is empty
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+}
+
+// Complete returns the manager settings of the configuration, it implements
+// the config.ControllerManagerConfiguration interface of controller-runtime
+func (c *OperatorConfig) Complete() (cfg.ControllerManagerConfigurationSpec, error) {
+	return c.ControllerManagerConfigurationSpec, nil
+}
+
+// Default fills the fields left empty with the built-in defaults
+func (c *OperatorConfig) Default() {
+	// The manager options are read from the leader election settings
+	// without checking they are set
+	if c.LeaderElection == nil {
+		c.LeaderElection = &componentconfig.LeaderElectionConfiguration{}
+	}
+	if c.MaxConcurrentReconciles == 0 {
+		c.MaxConcurrentReconciles = DefaultConcurrentReconciles
+	}
+	if c.ReconcileTimeout == nil {
+		c.ReconcileTimeout = &metav1.Duration{Duration: DefaultReconcileTimeout}
+	}
+	c.LearnDefaults.Default()
+}
+
+// Default fills the fields left empty with the built-in defaults
+func (d *LearnDefaults) Default() {
+	if d.Image == "" {
+		d.Image = DefaultImage
+	}
+	if d.Replicas == 0 {
+		d.Replicas = DefaultReplicas
+	}
+	if d.MinReplicas == 0 {
+		d.MinReplicas = DefaultMinReplicas
+	}
+	if d.MaxReplicas == 0 {
+		d.MaxReplicas = DefaultMaxReplicas
+	}
+}
+
+// Validate returns an error listing every invalid field of the configuration
+func (c *OperatorConfig) Validate() error {
+	var errs field.ErrorList
+	if c.SyncPeriod != nil && c.SyncPeriod.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("syncPeriod"), c.SyncPeriod.Duration.String(), "must be greater than zero"))
+	}
+	errs = append(errs, validateBindAddress(field.NewPath("metrics", "bindAddress"), c.Metrics.BindAddress)...)
+	errs = append(errs, validateBindAddress(field.NewPath("health", "healthProbeBindAddress"), c.Health.HealthProbeBindAddress)...)
+	if c.LeaderElection != nil && c.LeaderElection.LeaderElect != nil && *c.LeaderElection.LeaderElect && c.LeaderElection.ResourceName == "" {
+		errs = append(errs, field.Required(field.NewPath("leaderElection", "resourceName"), "required when leaderElect is true"))
+	}
+	for i, ns := range c.WatchNamespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(field.NewPath("watchNamespaces").Index(i), ns, msg))
+		}
+	}
+	if c.WatchNamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(c.WatchNamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("watchNamespaceSelector"), c.WatchNamespaceSelector, err.Error()))
+		}
+	}
+	if c.MaxConcurrentReconciles < 1 {
+		errs = append(errs, field.Invalid(field.NewPath("maxConcurrentReconciles"), c.MaxConcurrentReconciles, "must be at least 1"))
+	}
+	if c.ReconcileTimeout != nil && c.ReconcileTimeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("reconcileTimeout"), c.ReconcileTimeout.Duration.String(), "must be greater than zero"))
+	}
+	errs = append(errs, c.LearnDefaults.validate(field.NewPath("learnDefaults"))...)
+	return errs.ToAggregate()
+}
+
+func (d *LearnDefaults) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if !pinnedImage(d.Image) {
+		errs = append(errs, field.Invalid(path.Child("image"), d.Image, "must have a tag or a digest"))
+	}
+	if d.Replicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("replicas"), d.Replicas, "must be at least 1"))
+	}
+	if d.MinReplicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), d.MinReplicas, "must be at least 1"))
+	}
+	if d.MaxReplicas < d.MinReplicas {
+		errs = append(errs, field.Invalid(path.Child("maxReplicas"), d.MaxReplicas, "must not be lower than minReplicas"))
+	}
+	return errs
+}
+
+// pinnedImage returns true when the image reference has a tag or a digest.
+// The tag follows the last colon of the last path component, a colon before
+// the last slash separates the port of the registry, as in registry:5000/app.
+func pinnedImage(image string) bool {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return i > 0 && i < len(image)-1
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	return i > 0 && i < len(name)-1
+}
+
+// validateBindAddress accepts empty addresses, "0" which disables the endpoint, and host:port
+func validateBindAddress(path *field.Path, address string) field.ErrorList {
+	if address == "" || address == "0" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return field.ErrorList{field.Invalid(path, address, err.Error())}
+	}
+	return nil
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{})
+}
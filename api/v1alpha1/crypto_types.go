@@ -0,0 +1,72 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CryptoSpec defines the desired state of Crypto
+type CryptoSpec struct {
+	// Image to deploy
+	// +kubebuilder:validation:Pattern=".+:.+"
+	// +kubebuilder:default:="dxas90/learn:latest"
+	Image string `json:"image,omitempty"`
+	// Replicas that we need
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=15
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+// CryptoStatus defines the observed state of Crypto
+type CryptoStatus struct {
+	// Replicas is the number of pods of the Deployment
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// LabelSelector selects the pods of the Deployment
+	// +optional
+	LabelSelector string `json:"labelselector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas",description="The number of replicas requested"
+//+kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.replicas",description="The number of replicas running"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Crypto is the Schema for the cryptoes API
+type Crypto struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CryptoSpec   `json:"spec,omitempty"`
+	Status CryptoStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CryptoList contains a list of Crypto
+type CryptoList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Crypto `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Crypto{}, &CryptoList{})
+}
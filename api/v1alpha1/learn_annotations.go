@@ -0,0 +1,56 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	// AnnotationPaused set to "true" stops the operator from changing the
+	// resources of the Learn, its status is still updated
+	AnnotationPaused = "devops.dxas90/paused"
+	// AnnotationRequiresApproval set to "true" holds the changes of the spec
+	// until AnnotationApprovedSpecHash matches status.specHash
+	AnnotationRequiresApproval = "devops.dxas90/requires-approval"
+	// AnnotationApprovedSpecHash approves the spec whose hash it holds
+	AnnotationApprovedSpecHash = "devops.dxas90/approved-spec-hash"
+)
+
+// IsPaused reports whether the Learn carries the paused annotation
+func (in *Learn) IsPaused() bool {
+	return in.Annotations[AnnotationPaused] == "true"
+}
+
+// AwaitsApproval reports whether the Learn requires approval and its current
+// spec has not been approved
+func (in *Learn) AwaitsApproval() bool {
+	return in.Annotations[AnnotationRequiresApproval] == "true" &&
+		in.Annotations[AnnotationApprovedSpecHash] != in.SpecHash()
+}
+
+// SpecHash returns the hash of the spec approved through AnnotationApprovedSpecHash
+func (in *Learn) SpecHash() string {
+	data, err := json.Marshal(in.Spec)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -20,6 +20,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -42,6 +43,389 @@ type LearnSpec struct {
 	// +kubebuilder:validation:Max=15
 	// +kubebuilder:validation:default:=2
 	Replicas int32 `json:"replicas,omitempty"`
+	// Autoscaling configures the HorizontalPodAutoscaler of the app. The bounds
+	// left empty use the defaults of the operator configuration.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// Monitoring configures the Prometheus ServiceMonitor scraping the app
+	// +optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+	// Service configures how the Service of the app exposes it, a ClusterIP
+	// Service on the web port 8080 when empty
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+	// Gateway routes the traffic of Gateway API Gateways to the app with a
+	// gateway.networking.k8s.io/v1 HTTPRoute. The HTTPRoute CRD must be
+	// installed when the operator starts.
+	// +optional
+	Gateway *GatewaySpec `json:"gateway,omitempty"`
+	// PruneProtection lists the resources that are kept when the spec no
+	// longer asks for them. They are still deleted with the Learn.
+	// +optional
+	PruneProtection []ResourceRef `json:"pruneProtection,omitempty"`
+	// Teardown configures how the app is removed when the Learn is deleted
+	// +optional
+	Teardown *TeardownSpec `json:"teardown,omitempty"`
+	// ReconcileMode is Apply to change the cluster, or Plan to only report
+	// the changes Apply would make in status.plannedChanges
+	// +kubebuilder:validation:Enum=Apply;Plan
+	// +kubebuilder:default:=Apply
+	// +optional
+	ReconcileMode ReconcileMode `json:"reconcileMode,omitempty"`
+	// AdoptionPolicy decides what happens to an existing resource named like
+	// one of the Learn that the Learn does not control. Never leaves it alone
+	// and reports a Conflict, IfLabeled adopts it when it carries the
+	// devops.dxas90/adoptable: "true" label and Always adopts it. A resource
+	// controlled by another object is never adopted.
+	// +kubebuilder:validation:Enum=Never;IfLabeled;Always
+	// +kubebuilder:default:=Never
+	// +optional
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// NameOverride replaces the name of the Learn in the names of its
+	// resources. The ConfigMap and the ServiceAccount add the -conf and -sa
+	// suffixes to it. Changing it creates the resources under the new name
+	// and prunes the old ones. It is also how a Deployment created before the
+	// app.kubernetes.io labels, which keeps selecting its pods on the app and
+	// devops labels because selectors are immutable, moves to a Deployment
+	// selecting on app.kubernetes.io/name and app.kubernetes.io/instance. The
+	// Service selects on the app and devops labels the pods of both carry.
+	// +kubebuilder:validation:Pattern="^[a-z]([-a-z0-9]*[a-z0-9])?$"
+	// +kubebuilder:validation:MaxLength=58
+	// +optional
+	NameOverride string `json:"nameOverride,omitempty"`
+	// CommonLabels are set on every resource of the Learn and on its pods.
+	// The labels of the operator win over them. A label removed from the list
+	// is left on the resources.
+	// +optional
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// CommonAnnotations are set on every resource of the Learn and on its
+	// pods. An annotation removed from the list is left on the resources.
+	// +optional
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+}
+
+// ReconcileMode decides whether the operator changes the cluster
+type ReconcileMode string
+
+const (
+	// ReconcileApply changes the cluster to match the Learn
+	ReconcileApply ReconcileMode = "Apply"
+	// ReconcilePlan computes the changes with a server-side dry-run and changes nothing
+	ReconcilePlan ReconcileMode = "Plan"
+)
+
+// AdoptionPolicy decides whether the operator takes over existing resources
+type AdoptionPolicy string
+
+const (
+	// AdoptNever never takes over a resource the Learn did not create
+	AdoptNever AdoptionPolicy = "Never"
+	// AdoptIfLabeled takes over the resources carrying LabelAdoptable
+	AdoptIfLabeled AdoptionPolicy = "IfLabeled"
+	// AdoptAlways takes over any resource without a controller
+	AdoptAlways AdoptionPolicy = "Always"
+)
+
+// LabelAdoptable set to "true" on a resource lets a Learn whose adoption
+// policy is IfLabeled take it over
+const LabelAdoptable = "devops.dxas90/adoptable"
+
+// TeardownSpec defines the steps run before the resources of a deleted Learn are removed
+type TeardownSpec struct {
+	// ScaleDownTimeoutSeconds is how long the operator waits for the pods of
+	// the app to stop before it moves on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=120
+	// +optional
+	ScaleDownTimeoutSeconds int32 `json:"scaleDownTimeoutSeconds,omitempty"`
+	// PreDelete is a Job run once the app is scaled down, for example to
+	// drain queues or snapshot data
+	// +optional
+	PreDelete *PreDeleteHook `json:"preDelete,omitempty"`
+}
+
+// PreDeleteHook defines the Job run before the resources of a deleted Learn are removed.
+// Its pod runs as the ServiceAccount of the app and loads the ConfigMap of the app.
+type PreDeleteHook struct {
+	// Image of the Job, the image of the app when empty
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Command of the Job container
+	// +optional
+	Command []string `json:"command,omitempty"`
+	// Args of the Job container
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Env added to the Job container
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// TimeoutSeconds is how long the Job may run
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=300
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// FailurePolicy decides what happens when the Job fails or times out,
+	// Continue removes the Learn anyway and Abort keeps it until the Job is
+	// removed from the spec or the policy changes
+	// +kubebuilder:validation:Enum=Continue;Abort
+	// +kubebuilder:default:=Continue
+	// +optional
+	FailurePolicy PreDeleteFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// PreDeleteFailurePolicy decides what happens when the pre-delete Job fails
+type PreDeleteFailurePolicy string
+
+const (
+	// PreDeleteContinue removes the Learn even though the pre-delete Job failed
+	PreDeleteContinue PreDeleteFailurePolicy = "Continue"
+	// PreDeleteAbort keeps the Learn when the pre-delete Job failed
+	PreDeleteAbort PreDeleteFailurePolicy = "Abort"
+)
+
+// ResourceRef selects resources of a Learn by kind and, optionally, name
+type ResourceRef struct {
+	// Kind of the resources, for example HorizontalPodAutoscaler
+	Kind string `json:"kind"`
+	// Name of the resource, every resource of the kind when empty
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// AutoscalingSpec defines the bounds of the HorizontalPodAutoscaler
+type AutoscalingSpec struct {
+	// Enabled creates a HorizontalPodAutoscaler for the app, when false the
+	// Deployment runs spec.replicas pods. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// MinReplicas is the lower limit of replicas the autoscaler can scale down to
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of replicas the autoscaler can scale up to
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+}
+
+// MonitoringSpec defines how Prometheus scrapes the app
+type MonitoringSpec struct {
+	// Enabled creates a monitoring.coreos.com/v1 ServiceMonitor for the app
+	Enabled bool `json:"enabled,omitempty"`
+	// Port the app serves its metrics on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default:=9090
+	Port int32 `json:"port,omitempty"`
+	// Path of the metrics endpoint
+	// +kubebuilder:default:="/metrics"
+	Path string `json:"path,omitempty"`
+	// Interval between scrapes, for example 30s
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Labels added to the ServiceMonitor so Prometheus selects it
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ServiceType is how the Service of the app is exposed
+// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer;Headless
+type ServiceType string
+
+const (
+	// ServiceClusterIP exposes the app on a cluster-internal IP
+	ServiceClusterIP ServiceType = "ClusterIP"
+	// ServiceNodePort exposes the app on a port of every node
+	ServiceNodePort ServiceType = "NodePort"
+	// ServiceLoadBalancer exposes the app through the load balancer of the cloud provider
+	ServiceLoadBalancer ServiceType = "LoadBalancer"
+	// ServiceHeadless gives the Service no cluster IP, its DNS name resolves to the pods
+	ServiceHeadless ServiceType = "Headless"
+)
+
+// ServiceSpec defines how the Service of the app exposes it
+type ServiceSpec struct {
+	// Type of the Service. Switching between Headless and the other types
+	// recreates the Service, the cluster IP of a Service cannot change. The
+	// new Service is created once the old one is gone, which a load balancer
+	// finalizer can delay.
+	// +kubebuilder:default:=ClusterIP
+	// +optional
+	Type ServiceType `json:"type,omitempty"`
+	// Ports of the Service, the web port 8080 when empty. The metrics port
+	// of spec.monitoring is added unless one of them targets it or is named
+	// metrics, such a port is the one the ServiceMonitor scrapes.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Ports []ServicePort `json:"ports,omitempty"`
+	// LoadBalancerSourceRanges restricts the clients of a LoadBalancer Service to these CIDRs
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+	// ExternalTrafficPolicy of a NodePort or LoadBalancer Service, Local keeps
+	// the client source IP and only routes to the pods of the node
+	// +kubebuilder:validation:Enum=Cluster;Local
+	// +optional
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+	// SessionAffinity ClientIP sends the requests of a client to the same pod
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+	// SessionAffinityTimeoutSeconds is how long a client sticks to its pod,
+	// 10800 when empty
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=86400
+	// +optional
+	SessionAffinityTimeoutSeconds int32 `json:"sessionAffinityTimeoutSeconds,omitempty"`
+	// Annotations added to the Service, for example the
+	// external-dns.alpha.kubernetes.io/hostname annotation, whose hostnames
+	// are reported in status.endpoints
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ServicePort is a port of the Service of the app
+type ServicePort struct {
+	// Name of the port, the ServiceMonitor scrapes the port by name
+	// +kubebuilder:validation:Pattern="^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+	// +kubebuilder:validation:MaxLength=15
+	Name string `json:"name"`
+	// Port the Service listens on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// TargetPort is the number or the name of the port of the pods, Port when empty
+	// +optional
+	TargetPort *intstr.IntOrString `json:"targetPort,omitempty"`
+	// Protocol of the port
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	// +kubebuilder:default:=TCP
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	// NodePort fixes the port of a NodePort or LoadBalancer Service on the
+	// nodes, the API server allocates one when empty
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+}
+
+// GatewaySpec defines the HTTPRoute of the app
+type GatewaySpec struct {
+	// ParentRefs are the Gateways the route attaches to
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=32
+	ParentRefs []GatewayParentRef `json:"parentRefs"`
+	// Hostnames the route matches, every hostname of the listeners when empty
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Rules of the route, a single rule sending every request to the first
+	// port of the Service of the app when empty
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Rules []RouteRule `json:"rules,omitempty"`
+}
+
+// GatewayParentRef references a Gateway the route attaches to
+type GatewayParentRef struct {
+	// Name of the Gateway
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the Gateway, the namespace of the Learn when empty
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// SectionName is the listener of the Gateway, every listener when empty
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// RouteRule sends the requests matching one of its matches to its backends
+type RouteRule struct {
+	// Matches of the rule, every request when empty
+	// +kubebuilder:validation:MaxItems=8
+	// +optional
+	Matches []RouteMatch `json:"matches,omitempty"`
+	// BackendRefs are the Services the requests are split between, the
+	// Service of the app when empty
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	BackendRefs []RouteBackendRef `json:"backendRefs,omitempty"`
+	// Timeout of a request, for example 10s
+	// +kubebuilder:validation:Pattern="^([0-9]{1,5}(h|m|s|ms)){1,4}$"
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// RouteMatch selects requests by path and headers, all of which must match
+type RouteMatch struct {
+	// Path of the request, the prefix / when empty
+	// +optional
+	Path *RoutePathMatch `json:"path,omitempty"`
+	// Headers of the request
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Headers []RouteHeaderMatch `json:"headers,omitempty"`
+}
+
+// RoutePathMatch matches the path of a request
+type RoutePathMatch struct {
+	// Type of the match
+	// +kubebuilder:validation:Enum=Exact;PathPrefix;RegularExpression
+	// +kubebuilder:default:=PathPrefix
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Value of the path
+	// +kubebuilder:default:="/"
+	// +kubebuilder:validation:MaxLength=1024
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// RouteHeaderMatch matches a header of a request
+type RouteHeaderMatch struct {
+	// Type of the match
+	// +kubebuilder:validation:Enum=Exact;RegularExpression
+	// +kubebuilder:default:=Exact
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Name of the header
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Value of the header
+	// +kubebuilder:validation:MaxLength=4096
+	Value string `json:"value"`
+}
+
+// RouteBackendRef is a Service of the namespace of the Learn the requests are sent to
+type RouteBackendRef struct {
+	// Name of the Service, the Service of the app when empty
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Port of the Service, the first port of the Service of the app when empty
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Weight is the share of the requests of the rule the backend gets,
+	// relative to the other backends
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000000
+	// +kubebuilder:default:=1
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// Endpoint is an address the app is reachable at
+type Endpoint struct {
+	// Port is the name of the Service port
+	Port string `json:"port"`
+	// URL of the app, for example http://learn-sample.apps.svc:8080
+	URL string `json:"url"`
+	// External is true for the addresses reachable from outside the cluster
+	// +optional
+	External bool `json:"external,omitempty"`
 }
 
 // LearnStatus defines the observed state of Learn
@@ -58,14 +442,171 @@ type LearnStatus struct {
 	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Service Status"
 	ServiceStatus corev1.ServiceStatus `json:"serviceStatus"`
 
+	// Endpoints lists the URLs the app is reachable at: the in-cluster DNS
+	// name of the Service, the addresses of its load balancer and the
+	// hostnames of its external-dns annotation
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Endpoints"
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
 	// Status of the Status HorizontalPodAutoscaler created and managed by it
 	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
 	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Horizontal Pod Autoscaler Status"
 	// HorizontalPodAutoscalerStatus autoscalingv2beta2.HorizontalPodAutoscalerStatus `json:"hpaStatus"`
 
 	Status string `json:"status,omitempty"`
+
+	// Conditions represent the latest available observations of the Learn's state
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Conditions"
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Resources reports the outcome of the last reconcile of every resource of the Learn
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Resources"
+	Resources []ResourceStatus `json:"resources,omitempty"`
+
+	// Inventory lists the resources the operator created for the Learn. The
+	// ones the spec no longer asks for are pruned from the cluster.
+	// +optional
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
+
+	// Teardown reports the progress of the removal of a deleted Learn
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Teardown"
+	Teardown *TeardownStatus `json:"teardown,omitempty"`
+
+	// SpecHash is the hash of the spec, copy it to the
+	// devops.dxas90/approved-spec-hash annotation to approve the spec
+	// +optional
+	SpecHash string `json:"specHash,omitempty"`
+
+	// PlannedChanges lists the changes Apply would make, filled in Plan mode only
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Planned Changes"
+	PlannedChanges []PlannedChange `json:"plannedChanges,omitempty"`
+}
+
+// PlanAction is what Apply would do to a resource
+type PlanAction string
+
+const (
+	// PlanCreate means the resource does not exist yet
+	PlanCreate PlanAction = "Create"
+	// PlanUpdate means the live resource differs from the desired one
+	PlanUpdate PlanAction = "Update"
+	// PlanDelete means the resource would be pruned
+	PlanDelete PlanAction = "Delete"
+)
+
+// PlannedChange is a change Apply would make to a resource of the Learn
+type PlannedChange struct {
+	// Kind of the resource
+	Kind string `json:"kind"`
+	// Name of the resource
+	Name string `json:"name"`
+	// Action Apply would take
+	Action PlanAction `json:"action"`
+	// Fields lists the paths of the fields that would change, for example spec.replicas
+	// +optional
+	Fields []string `json:"fields,omitempty"`
+	// Error is set when the API server rejected the dry-run of the change
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// TeardownPhase is a step of the removal of a deleted Learn
+type TeardownPhase string
+
+const (
+	// TeardownScalingDown means the operator waits for the pods of the app to stop
+	TeardownScalingDown TeardownPhase = "ScalingDown"
+	// TeardownPreDelete means the operator waits for the pre-delete Job to finish
+	TeardownPreDelete TeardownPhase = "PreDelete"
+	// TeardownBlocked means the pre-delete Job failed and its failure policy is Abort
+	TeardownBlocked TeardownPhase = "Blocked"
+	// TeardownCompleted means the Learn is about to be removed
+	TeardownCompleted TeardownPhase = "Completed"
+)
+
+// TeardownStatus is the progress of the removal of a deleted Learn
+type TeardownStatus struct {
+	// Phase of the teardown
+	Phase TeardownPhase `json:"phase"`
+	// Message gives the details of the phase
+	// +optional
+	Message string `json:"message,omitempty"`
+	// PhaseStarted is when the phase started, the timeouts count from it
+	PhaseStarted metav1.Time `json:"phaseStarted"`
 }
 
+// InventoryEntry identifies a resource created by the operator
+type InventoryEntry struct {
+	// APIVersion of the resource
+	APIVersion string `json:"apiVersion"`
+	// Kind of the resource
+	Kind string `json:"kind"`
+	// Name of the resource
+	Name string `json:"name"`
+}
+
+// LabelOwnedBy is set on every resource the operator creates, its value is
+// the UID of the object owning the resource. Resources created by older
+// versions of the operator may lack it, their controller reference is what
+// marks them as owned.
+const LabelOwnedBy = "devops.dxas90/owned-by"
+
+// ResourceState is the outcome of the last reconcile of a resource
+// +kubebuilder:validation:Enum=Ready;Failed;Blocked;Disabled
+type ResourceState string
+
+const (
+	// ResourceReady means the resource was reconciled without error
+	ResourceReady ResourceState = "Ready"
+	// ResourceFailed means the reconcile of the resource failed, see lastError
+	ResourceFailed ResourceState = "Failed"
+	// ResourceBlocked means the resource was not reconciled because one it depends on is not ready
+	ResourceBlocked ResourceState = "Blocked"
+	// ResourceDisabled means the resource is not enabled by the spec
+	ResourceDisabled ResourceState = "Disabled"
+)
+
+// ResourceStatus is the outcome of the last reconcile of a resource of the Learn
+type ResourceStatus struct {
+	// Kind of the resource
+	Kind string `json:"kind"`
+	// Name of the resource
+	Name string `json:"name"`
+	// State of the resource after the last reconcile
+	State ResourceState `json:"state"`
+	// LastError is the error of the last reconcile, empty unless the state is Failed or Blocked
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// LastTransition is the last time the state or the error changed
+	LastTransition metav1.Time `json:"lastTransition"`
+}
+
+const (
+	// ConditionReady is True when every resource required by the Learn exists
+	ConditionReady = "Ready"
+	// ConditionServiceMonitorReady reports the ServiceMonitor requested by spec.monitoring
+	ConditionServiceMonitorReady = "ServiceMonitorReady"
+	// ConditionPaused is True while the operator leaves the resources of the
+	// Learn untouched, because of the paused annotation or a spec awaiting approval
+	ConditionPaused = "Paused"
+	// ConditionRouteAccepted reports whether the Gateways of spec.gateway
+	// accepted the HTTPRoute of the Learn and resolved its backends
+	ConditionRouteAccepted = "RouteAccepted"
+	// ConditionConflict is True while a resource named like one of the Learn
+	// exists without being controlled by it and the adoption policy refuses it
+	ConditionConflict = "Conflict"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas",description="The number of jobs launched"
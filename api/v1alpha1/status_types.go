@@ -0,0 +1,99 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatusSpec defines the desired state of Status
+type StatusSpec struct {
+	// Image to deploy
+	// +kubebuilder:validation:Pattern=".+:.+"
+	// +kubebuilder:default:="dxas90/learn:latest"
+	Image string `json:"image,omitempty"`
+	// Replicas that we need
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=15
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// Autoscaling configures the HorizontalPodAutoscaler of the app. The bounds
+	// left empty use the defaults of the operator configuration.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+}
+
+// StatusStatus defines the observed state of Status
+type StatusStatus struct {
+	// CurrentStatus summarises the resources of the Status, OK once all of them exist
+	// +optional
+	CurrentStatus string `json:"currentStatus,omitempty"`
+
+	// Status of the Status Deployment created and managed by it
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Deployment Status"
+	DeploymentStatus appsv1.DeploymentStatus `json:"deploymentStatus"`
+
+	// Status of the Status Service created and managed by it
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Service Status"
+	ServiceStatus corev1.ServiceStatus `json:"serviceStatus"`
+
+	// Status of the Status HorizontalPodAutoscaler created and managed by it
+	// +optional
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Horizontal Pod Autoscaler Status"
+	HorizontalPodAutoscalerStatus *autoscalingv2beta2.HorizontalPodAutoscalerStatus `json:"hpaStatus,omitempty"`
+
+	// Replicas is the number of pods of the Deployment
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// LabelSelector selects the pods of the Deployment
+	// +optional
+	LabelSelector string `json:"labelselector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas",description="The number of replicas requested"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.currentStatus",description="Status Status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Status is the Schema for the statuses API
+type Status struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StatusSpec   `json:"spec,omitempty"`
+	Status StatusStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// StatusList contains a list of Status
+type StatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Status `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Status{}, &StatusList{})
+}
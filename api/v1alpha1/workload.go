@@ -0,0 +1,213 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AppWorkload is implemented by the kinds of the group that run the app. The
+// resource builders of the operator work against it, so every kind gets the
+// same Deployment, Service, HorizontalPodAutoscaler, ConfigMap and
+// ServiceAccount.
+// +kubebuilder:object:generate=false
+type AppWorkload interface {
+	metav1.Object
+	runtime.Object
+
+	// AppImage is the container image of the app
+	AppImage() string
+	// AppReplicas is the number of pods of the app when it is not autoscaled
+	AppReplicas() int32
+	// AppAutoscaling bounds the HorizontalPodAutoscaler of the app, nil when
+	// the kind runs a fixed number of pods
+	AppAutoscaling() *AutoscalingSpec
+	// AppMonitoring configures how Prometheus scrapes the app, nil when it is not scraped
+	AppMonitoring() *MonitoringSpec
+	// AppPodOptions returns the names of the resources the pods of the app use
+	AppPodOptions() PodOptions
+	// AppAdoptionPolicy decides whether the existing resources named like the
+	// ones of the app are taken over
+	AppAdoptionPolicy() AdoptionPolicy
+	// AppName is the name of the resources of the app
+	AppName() string
+	// AppCommonMetadata returns the labels and annotations set on every
+	// resource of the app and on its pods
+	AppCommonMetadata() CommonMetadata
+	// AppService configures the Service of the app, nil for a ClusterIP
+	// Service on the web port
+	AppService() *ServiceSpec
+	// AppGateway configures the HTTPRoute of the app, nil when it has none
+	AppGateway() *GatewaySpec
+}
+
+// PodOptions are the names of the resources the pods of an AppWorkload use
+// +kubebuilder:object:generate=false
+type PodOptions struct {
+	// ConfigMapName is the ConfigMap mounted at /conf and loaded into the environment
+	ConfigMapName string
+	// ServiceAccountName is the ServiceAccount the pods run as
+	ServiceAccountName string
+}
+
+// CommonMetadata are the labels and annotations an AppWorkload sets on all its resources
+// +kubebuilder:object:generate=false
+type CommonMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// defaultPodOptions returns the options every kind of the group uses, the
+// ConfigMap and ServiceAccount are named after the object
+func defaultPodOptions(name string) PodOptions {
+	return PodOptions{
+		ConfigMapName:      name + "-conf",
+		ServiceAccountName: name + "-sa",
+	}
+}
+
+var (
+	_ AppWorkload = &Learn{}
+	_ AppWorkload = &Status{}
+	_ AppWorkload = &Crypto{}
+)
+
+// AppImage implements AppWorkload
+func (in *Learn) AppImage() string { return in.Spec.Image }
+
+// AppReplicas implements AppWorkload
+func (in *Learn) AppReplicas() int32 { return in.Spec.Replicas }
+
+// AppAutoscaling implements AppWorkload, a Learn is autoscaled unless
+// spec.autoscaling.enabled is false
+func (in *Learn) AppAutoscaling() *AutoscalingSpec {
+	if in.Spec.Autoscaling == nil {
+		return &AutoscalingSpec{}
+	}
+	if !in.Spec.Autoscaling.IsEnabled() {
+		return nil
+	}
+	return in.Spec.Autoscaling
+}
+
+// AppMonitoring implements AppWorkload
+func (in *Learn) AppMonitoring() *MonitoringSpec { return in.Spec.Monitoring }
+
+// AppPodOptions implements AppWorkload
+func (in *Learn) AppPodOptions() PodOptions { return defaultPodOptions(in.AppName()) }
+
+// AppAdoptionPolicy implements AppWorkload, Never when the spec leaves it empty
+func (in *Learn) AppAdoptionPolicy() AdoptionPolicy {
+	if in.Spec.AdoptionPolicy == "" {
+		return AdoptNever
+	}
+	return in.Spec.AdoptionPolicy
+}
+
+// AppName implements AppWorkload, spec.nameOverride when it is set
+func (in *Learn) AppName() string {
+	if in.Spec.NameOverride != "" {
+		return in.Spec.NameOverride
+	}
+	return in.Name
+}
+
+// AppCommonMetadata implements AppWorkload
+func (in *Learn) AppCommonMetadata() CommonMetadata {
+	return CommonMetadata{Labels: in.Spec.CommonLabels, Annotations: in.Spec.CommonAnnotations}
+}
+
+// AppService implements AppWorkload
+func (in *Learn) AppService() *ServiceSpec { return in.Spec.Service }
+
+// AppGateway implements AppWorkload
+func (in *Learn) AppGateway() *GatewaySpec { return in.Spec.Gateway }
+
+// AppImage implements AppWorkload
+func (in *Status) AppImage() string { return in.Spec.Image }
+
+// AppReplicas implements AppWorkload
+func (in *Status) AppReplicas() int32 { return in.Spec.Replicas }
+
+// AppAutoscaling implements AppWorkload, a Status is autoscaled unless
+// spec.autoscaling.enabled is false
+func (in *Status) AppAutoscaling() *AutoscalingSpec {
+	if in.Spec.Autoscaling == nil {
+		return &AutoscalingSpec{}
+	}
+	if !in.Spec.Autoscaling.IsEnabled() {
+		return nil
+	}
+	return in.Spec.Autoscaling
+}
+
+// AppMonitoring implements AppWorkload, a Status is not scraped
+func (in *Status) AppMonitoring() *MonitoringSpec { return nil }
+
+// AppPodOptions implements AppWorkload
+func (in *Status) AppPodOptions() PodOptions { return defaultPodOptions(in.Name) }
+
+// AppAdoptionPolicy implements AppWorkload, a Status never adopts
+func (in *Status) AppAdoptionPolicy() AdoptionPolicy { return AdoptNever }
+
+// AppName implements AppWorkload
+func (in *Status) AppName() string { return in.Name }
+
+// AppCommonMetadata implements AppWorkload, a Status has none
+func (in *Status) AppCommonMetadata() CommonMetadata { return CommonMetadata{} }
+
+// AppService implements AppWorkload, a Status uses the default Service
+func (in *Status) AppService() *ServiceSpec { return nil }
+
+// AppGateway implements AppWorkload, a Status has no HTTPRoute
+func (in *Status) AppGateway() *GatewaySpec { return nil }
+
+// AppImage implements AppWorkload
+func (in *Crypto) AppImage() string { return in.Spec.Image }
+
+// AppReplicas implements AppWorkload
+func (in *Crypto) AppReplicas() int32 { return in.Spec.Replicas }
+
+// AppAutoscaling implements AppWorkload, a Crypto runs a fixed number of pods
+func (in *Crypto) AppAutoscaling() *AutoscalingSpec { return nil }
+
+// AppMonitoring implements AppWorkload, a Crypto is not scraped
+func (in *Crypto) AppMonitoring() *MonitoringSpec { return nil }
+
+// AppPodOptions implements AppWorkload
+func (in *Crypto) AppPodOptions() PodOptions { return defaultPodOptions(in.Name) }
+
+// AppAdoptionPolicy implements AppWorkload, a Crypto never adopts
+func (in *Crypto) AppAdoptionPolicy() AdoptionPolicy { return AdoptNever }
+
+// AppName implements AppWorkload
+func (in *Crypto) AppName() string { return in.Name }
+
+// AppCommonMetadata implements AppWorkload, a Crypto has none
+func (in *Crypto) AppCommonMetadata() CommonMetadata { return CommonMetadata{} }
+
+// AppService implements AppWorkload, a Crypto uses the default Service
+func (in *Crypto) AppService() *ServiceSpec { return nil }
+
+// AppGateway implements AppWorkload, a Crypto has no HTTPRoute
+func (in *Crypto) AppGateway() *GatewaySpec { return nil }
+
+// IsEnabled reports whether the HorizontalPodAutoscaler is enabled, it is unless Enabled is false
+func (in *AutoscalingSpec) IsEnabled() bool {
+	return in == nil || in.Enabled == nil || *in.Enabled
+}
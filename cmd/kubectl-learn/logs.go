@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// logs prints the logs of the pods of the Learn, every line prefixed with the
+// name of its pod. With -f the logs of all the pods are followed at once.
+func (p *plugin) logs(ctx context.Context, name string, args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := flags.Bool("f", false, "Follow the logs of the pods.")
+	tail := flags.Int64("tail", -1, "The number of lines to print from the end of the logs of every pod, all of them when negative.")
+	container := flags.String("c", "", "The container to print the logs of, the app container when empty.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.podsOf(ctx, learn)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no pod of Learn %s found", learn.Name)
+	}
+
+	opts := &corev1.PodLogOptions{Container: *container, Follow: *follow}
+	if opts.Container == "" {
+		// The builders name the app container after the app
+		opts.Container = learn.AppName()
+	}
+	if *tail >= 0 {
+		opts.TailLines = tail
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make([]error, len(pods))
+	)
+	for i := range pods {
+		stream := func(i int) {
+			errs[i] = p.streamLogs(ctx, pods[i].Name, opts, &mu)
+		}
+		if !*follow {
+			// Print the pods one after the other so their lines are not interleaved
+			stream(i)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stream(i)
+		}(i)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// streamLogs copies the logs of pod to the output of the plugin line by line,
+// holding mu while writing a line
+func (p *plugin) streamLogs(ctx context.Context, pod string, opts *corev1.PodLogOptions, mu *sync.Mutex) error {
+	stream, err := p.clientset.CoreV1().Pods(p.namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("pod %s: %w", pod, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		mu.Lock()
+		_, err := fmt.Fprintf(p.out, "[%s] %s\n", pod, scanner.Text())
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return fmt.Errorf("pod %s: %w", pod, err)
+	}
+	return nil
+}
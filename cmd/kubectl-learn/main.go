@@ -0,0 +1,143 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-learn is a kubectl plugin inspecting and operating the apps
+// of Learn objects. Installed in the PATH it runs as
+//
+//	kubectl learn status learn-sample
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(devopsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
+}
+
+const usage = `kubectl learn inspects and operates the apps of Learn objects.
+
+Usage:
+  kubectl learn [-n NAMESPACE] [--kubeconfig FILE] [--config FILE] COMMAND NAME [flags]
+
+Commands:
+  status   Show the health of the Learn and of every resource it owns
+  tree     Show the resources owned by the Learn, following owner references
+  restart  Restart the pods of the Learn with a rollout of its Deployment
+  pause    Stop the operator from changing the resources of the Learn
+  resume   Let the operator change the resources of the Learn again
+  diff     Show the changes the operator would make to the live resources
+  logs     Print the logs of the pods of the Learn
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "kubectl-learn:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags, connects to the cluster and runs the command of args
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("kubectl-learn", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	namespace := flags.String("n", "", "The namespace of the Learn, the one of the kubeconfig context when empty.")
+	kubeconfig := flags.String("kubeconfig", "", "The kubeconfig file, the default loading rules of kubectl apply when empty.")
+	configFile := flags.String("config", "", "The configuration file of the operator, status and diff apply its learnDefaults "+
+		"as the operator does. The built-in defaults are used when empty.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a command and the name of a Learn")
+	}
+
+	defaults, err := loadLearnDefaults(*configFile)
+	if err != nil {
+		return err
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	if *namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			return err
+		}
+		*namespace = ns
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	p := &plugin{client: c, clientset: clientset, namespace: *namespace, defaults: defaults, out: stdout}
+	return p.run(context.Background(), flags.Arg(0), flags.Arg(1), flags.Args()[2:])
+}
+
+// loadLearnDefaults returns the Learn defaults of the OperatorConfig file at
+// path, decoded and defaulted as the operator does, the built-in defaults when
+// path is empty
+func loadLearnDefaults(path string) (configv1alpha1.LearnDefaults, error) {
+	config := &configv1alpha1.OperatorConfig{}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return config.LearnDefaults, err
+		}
+		decoder := json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme, scheme,
+			json.SerializerOptions{Yaml: true, Strict: true})
+		if err := runtime.DecodeInto(decoder, content, config); err != nil {
+			return config.LearnDefaults, fmt.Errorf("unable to decode %s: %w", path, err)
+		}
+	}
+	config.Default()
+	if err := config.Validate(); err != nil {
+		return config.LearnDefaults, err
+	}
+	return config.LearnDefaults, nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"github.com/dxas90/learn-operator/controllers"
+)
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout restart sets
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// plugin runs the commands of kubectl-learn against a cluster
+type plugin struct {
+	client client.Client
+	// clientset streams the logs of the pods
+	clientset kubernetes.Interface
+	namespace string
+	// defaults are the Learn defaults of the operator, applied before the
+	// resources of a Learn are rendered or planned
+	defaults configv1alpha1.LearnDefaults
+	out      io.Writer
+	// now returns the current time, replaced by the tests
+	now func() time.Time
+}
+
+// run runs command on the Learn called name
+func (p *plugin) run(ctx context.Context, command, name string, args []string) error {
+	switch command {
+	case "status":
+		return p.status(ctx, name)
+	case "tree":
+		return p.tree(ctx, name)
+	case "restart":
+		return p.restart(ctx, name)
+	case "pause":
+		return p.setPaused(ctx, name, true)
+	case "resume":
+		return p.setPaused(ctx, name, false)
+	case "diff":
+		return p.diff(ctx, name)
+	case "logs":
+		return p.logs(ctx, name, args)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// getLearn returns the Learn called name
+func (p *plugin) getLearn(ctx context.Context, name string) (*devopsv1alpha1.Learn, error) {
+	learn := &devopsv1alpha1.Learn{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: name, Namespace: p.namespace}, learn); err != nil {
+		return nil, err
+	}
+	return learn, nil
+}
+
+// status prints the Ready condition of the Learn and the health of every
+// resource the operator manages for it
+func (p *plugin) status(ctx context.Context, name string) error {
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	healthy := meta.IsStatusConditionTrue(learn.Status.Conditions, devopsv1alpha1.ConditionReady)
+	var rows []string
+	for _, desired := range controllers.RenderLearn(learn, p.defaults, scheme) {
+		gvk, err := apiutil.GVKForObject(desired, scheme)
+		if err != nil {
+			return err
+		}
+		health, details, err := p.resourceHealth(ctx, learn, desired)
+		if err != nil {
+			return err
+		}
+		if health != "Healthy" {
+			healthy = false
+		}
+		rows = append(rows, strings.Join([]string{gvk.Kind, desired.GetName(), health, details}, "\t"))
+	}
+
+	overall := "Degraded"
+	if healthy {
+		overall = "Healthy"
+	}
+	fmt.Fprintf(p.out, "Learn %s/%s is %s\n", learn.Namespace, learn.Name, overall)
+	if learn.Status.Status != "" {
+		fmt.Fprintf(p.out, "Status: %s\n", learn.Status.Status)
+	}
+	for _, condition := range learn.Status.Conditions {
+		fmt.Fprintf(p.out, "%s: %s (%s) %s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+	}
+	for _, endpoint := range learn.Status.Endpoints {
+		fmt.Fprintf(p.out, "Endpoint %s: %s\n", endpoint.Port, endpoint.URL)
+	}
+	fmt.Fprintln(p.out)
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tHEALTH\tDETAILS")
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	return w.Flush()
+}
+
+// resourceHealth fetches the live resource of desired and returns whether it
+// is Healthy, Progressing, Degraded or Missing, with a short description
+func (p *plugin) resourceHealth(ctx context.Context, learn *devopsv1alpha1.Learn, desired client.Object) (health, details string, err error) {
+	name, ns := desired.GetName(), desired.GetNamespace()
+	switch desired.(type) {
+	case *appsv1.Deployment:
+		dep, err := controllers.Fetch[*appsv1.Deployment](ctx, name, ns, p.client)
+		if err != nil {
+			return missing(err)
+		}
+		health = "Healthy"
+		if dep.Status.Replicas == 0 || dep.Status.AvailableReplicas < dep.Status.Replicas || dep.Status.UpdatedReplicas < dep.Status.Replicas {
+			health = "Progressing"
+		}
+		return health, fmt.Sprintf("%d/%d available, image %s", dep.Status.AvailableReplicas, dep.Status.Replicas, dep.Spec.Template.Spec.Containers[0].Image), nil
+	case *corev1.Service:
+		svc, err := controllers.Fetch[*corev1.Service](ctx, name, ns, p.client)
+		if err != nil {
+			return missing(err)
+		}
+		health = "Healthy"
+		// The cloud provider has not given the load balancer an address yet
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) == 0 {
+			health = "Progressing"
+		}
+		return health, fmt.Sprintf("%s %s", svc.Spec.Type, svc.Spec.ClusterIP), nil
+	case *corev1.ConfigMap:
+		cm, err := controllers.Fetch[*corev1.ConfigMap](ctx, name, ns, p.client)
+		if err != nil {
+			return missing(err)
+		}
+		return "Healthy", fmt.Sprintf("%d keys", len(cm.Data)), nil
+	case *corev1.ServiceAccount:
+		if _, err := controllers.Fetch[*corev1.ServiceAccount](ctx, name, ns, p.client); err != nil {
+			return missing(err)
+		}
+		return "Healthy", "", nil
+	case *autoscalingv2beta2.HorizontalPodAutoscaler:
+		hpa, err := controllers.Fetch[*autoscalingv2beta2.HorizontalPodAutoscaler](ctx, name, ns, p.client)
+		if err != nil {
+			return missing(err)
+		}
+		var min int32 = 1
+		if hpa.Spec.MinReplicas != nil {
+			min = *hpa.Spec.MinReplicas
+		}
+		return "Healthy", fmt.Sprintf("%d replicas, %d to %d", hpa.Status.CurrentReplicas, min, hpa.Spec.MaxReplicas), nil
+	case *unstructured.Unstructured:
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(desired.GetObjectKind().GroupVersionKind())
+		if err := p.client.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, live); err != nil {
+			if meta.IsNoMatchError(err) {
+				return "Missing", "CRD not installed", nil
+			}
+			return missing(err)
+		}
+		switch live.GetKind() {
+		case "ServiceMonitor":
+			endpoints, _, _ := unstructured.NestedSlice(live.Object, "spec", "endpoints")
+			return "Healthy", fmt.Sprintf("%d endpoints", len(endpoints)), nil
+		case "HTTPRoute":
+			// Read as the operator reads it for the RouteAccepted condition
+			reason, message := controllers.RouteAcceptance(learn, live)
+			switch reason {
+			case "Accepted":
+				return "Healthy", message, nil
+			case "Pending":
+				return "Progressing", message, nil
+			}
+			return "Degraded", reason + ": " + message, nil
+		}
+	}
+	return "Unknown", "", nil
+}
+
+// missing returns the health of a resource that could not be fetched with err
+func missing(err error) (string, string, error) {
+	if controllers.IsNotFound(err) {
+		return "Missing", "", nil
+	}
+	return "", "", err
+}
+
+// treeKinds are the kinds listed to build the tree of a Learn, with the
+// optional kinds of controllers.ServedOptionalKinds
+var treeKinds = []client.ObjectList{
+	&appsv1.DeploymentList{},
+	&appsv1.ReplicaSetList{},
+	&corev1.PodList{},
+	&corev1.ServiceList{},
+	&corev1.ConfigMapList{},
+	&corev1.ServiceAccountList{},
+	&autoscalingv2beta2.HorizontalPodAutoscalerList{},
+	&batchv1.JobList{},
+}
+
+// tree prints the resources owned by the Learn, and the ones they own, from
+// their owner references
+func (p *plugin) tree(ctx context.Context, name string) error {
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	children := map[types.UID][]client.Object{}
+	// The optional CRDs may not be installed
+	optional, err := controllers.ServedOptionalKinds(p.client.RESTMapper())
+	if err != nil {
+		return err
+	}
+	lists := make([]client.ObjectList, 0, len(treeKinds)+len(optional))
+	for _, list := range treeKinds {
+		lists = append(lists, list.DeepCopyObject().(client.ObjectList))
+	}
+	for _, gvk := range optional {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		lists = append(lists, list)
+	}
+	for _, list := range lists {
+		if err := p.client.List(ctx, list, client.InNamespace(p.namespace)); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj := item.(client.Object)
+			for _, ref := range obj.GetOwnerReferences() {
+				children[ref.UID] = append(children[ref.UID], obj)
+			}
+		}
+	}
+
+	fmt.Fprintf(p.out, "Learn/%s\n", learn.Name)
+	return p.printChildren(children, learn.UID, "")
+}
+
+// printChildren prints the resources owned by uid, sorted by kind and name
+func (p *plugin) printChildren(children map[types.UID][]client.Object, uid types.UID, indent string) error {
+	owned := children[uid]
+	kinds := make([]string, len(owned))
+	for i, obj := range owned {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return err
+		}
+		kinds[i] = gvk.Kind + "/" + obj.GetName()
+	}
+	order := make([]int, len(owned))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return kinds[order[i]] < kinds[order[j]] })
+
+	for n, i := range order {
+		branch, next := "├── ", "│   "
+		if n == len(order)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(p.out, "%s%s%s\n", indent, branch, kinds[i])
+		if err := p.printChildren(children, owned[i].GetUID(), indent+next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restart triggers a rollout of the Deployment of the Learn, as kubectl
+// rollout restart does
+func (p *plugin) restart(ctx context.Context, name string) error {
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+	dep, err := controllers.Fetch[*appsv1.Deployment](ctx, learn.AppName(), learn.Namespace, p.client)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(dep.DeepCopy())
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = map[string]string{}
+	}
+	dep.Spec.Template.Annotations[restartedAtAnnotation] = p.clock().Format(time.RFC3339)
+	if err := p.client.Patch(ctx, dep, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "Deployment %s restarted\n", dep.Name)
+	return nil
+}
+
+// setPaused sets or removes the paused annotation of the Learn
+func (p *plugin) setPaused(ctx context.Context, name string, paused bool) error {
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(learn.DeepCopy())
+	annotations := learn.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	verb := "paused"
+	if paused {
+		annotations[devopsv1alpha1.AnnotationPaused] = "true"
+	} else {
+		delete(annotations, devopsv1alpha1.AnnotationPaused)
+		verb = "resumed"
+	}
+	learn.SetAnnotations(annotations)
+	if err := p.client.Patch(ctx, learn, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "Learn %s %s\n", learn.Name, verb)
+	return nil
+}
+
+// diff prints the changes the operator would make to the live resources of
+// the Learn, computed with a server-side dry-run as in Plan mode
+func (p *plugin) diff(ctx context.Context, name string) error {
+	learn, err := p.getLearn(ctx, name)
+	if err != nil {
+		return err
+	}
+	// The HTTPRoute is only planned when the cluster serves it, as the operator does
+	gatewayAPI, err := controllers.GatewayAPIInstalled(p.client.RESTMapper())
+	if err != nil {
+		return err
+	}
+	r := &controllers.LearnReconciler{Client: p.client, Scheme: scheme, Defaults: p.defaults, GatewayAPI: gatewayAPI}
+	changes, err := r.PlanChanges(ctx, learn)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(p.out, "Learn %s is up to date\n", learn.Name)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Fprintf(p.out, "%s %s/%s\n", change.Action, change.Kind, change.Name)
+		for _, field := range change.Fields {
+			fmt.Fprintf(p.out, "  ~ %s\n", field)
+		}
+		if change.Error != "" {
+			fmt.Fprintf(p.out, "  ! %s\n", change.Error)
+		}
+	}
+	return nil
+}
+
+// clock returns the current time
+func (p *plugin) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// podsOf returns the pods of the Learn, picked by the app labels the builders set
+func (p *plugin) podsOf(ctx context.Context, learn *devopsv1alpha1.Learn) ([]*corev1.Pod, error) {
+	pods, err := controllers.ListOwned[*corev1.Pod](ctx, p.client, scheme, learn, controllers.MatchAppLabels)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
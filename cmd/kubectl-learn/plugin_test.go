@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"github.com/dxas90/learn-operator/controllers"
+)
+
+var (
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	httpRouteGVK      = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+)
+
+// sampleLearn returns the Learn the plugin is run on
+func sampleLearn() *devopsv1alpha1.Learn {
+	return &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+}
+
+// newPlugin returns a plugin on a fake cluster holding a Learn with all its
+// resources created, as the operator would
+func newPlugin(t *testing.T, objs ...client.Object) (*plugin, *bytes.Buffer) {
+	t.Helper()
+	return newPluginFor(t, sampleLearn(), objs...)
+}
+
+// newPluginFor returns a plugin on a fake cluster holding learn with all its
+// resources created. The fake cluster does not serve the optional kinds until
+// serveKind is called.
+func newPluginFor(t *testing.T, learn *devopsv1alpha1.Learn, objs ...client.Object) (*plugin, *bytes.Buffer) {
+	t.Helper()
+	objs = append(objs, learn)
+	for _, obj := range controllers.RenderLearn(learn, configv1alpha1.LearnDefaults{}, scheme) {
+		if dep, ok := obj.(*appsv1.Deployment); ok {
+			dep.UID = "deployment-uid"
+			dep.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+		}
+		objs = append(objs, obj)
+	}
+	// The fake client stores the optional kinds as unstructured objects
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	utilruntime.Must(devopsv1alpha1.AddToScheme(s))
+	for _, gvk := range []schema.GroupVersionKind{serviceMonitorGVK, httpRouteGVK} {
+		s.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	mapper := meta.NewDefaultRESTMapper(scheme.PrioritizedVersionsAllGroups())
+	for gvk := range scheme.AllKnownTypes() {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	out := &bytes.Buffer{}
+	return &plugin{
+		client: restMapperClient{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+			mapper: mapper,
+		},
+		clientset: fakeclientset.NewSimpleClientset(),
+		namespace: "default",
+		out:       out,
+		now:       func() time.Time { return time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC) },
+	}, out
+}
+
+// restMapperClient gives a RESTMapper to the fake client, which has none
+type restMapperClient struct {
+	client.Client
+	mapper *meta.DefaultRESTMapper
+}
+
+func (c restMapperClient) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+// serveKind makes the fake cluster of p serve the kind of gvk, as when its CRD is installed
+func serveKind(p *plugin, gvk schema.GroupVersionKind) {
+	p.client.(restMapperClient).mapper.Add(gvk, meta.RESTScopeNamespace)
+}
+
+func TestStatusReportsChildren(t *testing.T) {
+	p, out := newPlugin(t)
+	if err := p.run(context.Background(), "status", "learn-sample", nil); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+	got := out.String()
+	// Without a Ready condition the Learn has not been reconciled yet
+	if !strings.Contains(got, "is Degraded") {
+		t.Errorf("status output misses the overall health:\n%s", got)
+	}
+	for _, kind := range []string{"ConfigMap", "ServiceAccount", "Deployment", "Service", "HorizontalPodAutoscaler"} {
+		if !strings.Contains(got, kind) {
+			t.Errorf("status output misses %s:\n%s", kind, got)
+		}
+	}
+	if !strings.Contains(got, "2/2 available, image dxas90/learn:1.0.0") {
+		t.Errorf("status output misses the Deployment details:\n%s", got)
+	}
+}
+
+func TestTreeFollowsOwnerReferences(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "learn-sample-abc", Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "learn-sample", UID: "deployment-uid"}},
+	}}
+	p, out := newPlugin(t, pod)
+	if err := p.run(context.Background(), "tree", "learn-sample", nil); err != nil {
+		t.Fatalf("tree error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"Learn/learn-sample", "── Deployment/learn-sample", "│   └── Pod/learn-sample-abc", "── ConfigMap/learn-sample-conf"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree output misses %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	p, _ := newPlugin(t)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "learn-sample", Namespace: "default"}
+	if err := p.run(ctx, "pause", "learn-sample", nil); err != nil {
+		t.Fatalf("pause error = %v", err)
+	}
+	learn := &devopsv1alpha1.Learn{}
+	if err := p.client.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	if !learn.IsPaused() {
+		t.Errorf("Learn not paused, annotations = %v", learn.Annotations)
+	}
+
+	if err := p.run(ctx, "resume", "learn-sample", nil); err != nil {
+		t.Fatalf("resume error = %v", err)
+	}
+	learn = &devopsv1alpha1.Learn{}
+	if err := p.client.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	if learn.IsPaused() {
+		t.Errorf("Learn still paused, annotations = %v", learn.Annotations)
+	}
+}
+
+func TestRestartAnnotatesPodTemplate(t *testing.T) {
+	p, _ := newPlugin(t)
+	if err := p.run(context.Background(), "restart", "learn-sample", nil); err != nil {
+		t.Fatalf("restart error = %v", err)
+	}
+	dep, err := controllers.Fetch[*appsv1.Deployment](context.Background(), "learn-sample", "default", p.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dep.Spec.Template.Annotations[restartedAtAnnotation]; got != "2021-06-01T00:00:00Z" {
+		t.Errorf("%s = %q, want the current time", restartedAtAnnotation, got)
+	}
+}
+
+func TestDiffShowsChangedFields(t *testing.T) {
+	p, out := newPlugin(t)
+	ctx := context.Background()
+	learn := &devopsv1alpha1.Learn{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: "learn-sample", Namespace: "default"}, learn); err != nil {
+		t.Fatal(err)
+	}
+	learn.Spec.Image = "dxas90/learn:2.0.0"
+	if err := p.client.Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.run(ctx, "diff", "learn-sample", nil); err != nil {
+		t.Fatalf("diff error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Update Deployment/learn-sample") || !strings.Contains(got, "~ spec.template.spec.containers") {
+		t.Errorf("diff output misses the image change:\n%s", got)
+	}
+}
+
+func TestLogsPrefixesPodName(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "learn-sample-abc", Namespace: "default", Labels: map[string]string{"app": "learn-sample", "devops": "learn-sample"},
+	}}
+	p, out := newPlugin(t, pod)
+	p.clientset = fakeclientset.NewSimpleClientset(pod)
+	if err := p.run(context.Background(), "logs", "learn-sample", []string{"--tail", "10"}); err != nil {
+		t.Fatalf("logs error = %v", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "[learn-sample-abc] ") {
+		t.Errorf("logs output = %q, want the lines prefixed with the pod name", got)
+	}
+}
+
+func TestStatusReportsServiceMonitor(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Monitoring = &devopsv1alpha1.MonitoringSpec{Enabled: true, Port: 9090, Path: "/metrics"}
+	p, out := newPluginFor(t, learn)
+	serveKind(p, serviceMonitorGVK)
+	if err := p.run(context.Background(), "status", "learn-sample", nil); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "ServiceMonitor") || !strings.Contains(got, "1 endpoints") {
+		t.Errorf("status output misses the ServiceMonitor:\n%s", got)
+	}
+}
+
+func TestTreeListsServedOptionalKinds(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Monitoring = &devopsv1alpha1.MonitoringSpec{Enabled: true, Port: 9090, Path: "/metrics"}
+	p, out := newPluginFor(t, learn)
+	if err := p.run(context.Background(), "tree", "learn-sample", nil); err != nil {
+		t.Fatalf("tree error = %v", err)
+	}
+	if got := out.String(); strings.Contains(got, "ServiceMonitor") {
+		t.Errorf("tree lists the ServiceMonitor of a CRD not served:\n%s", got)
+	}
+
+	out.Reset()
+	serveKind(p, serviceMonitorGVK)
+	if err := p.run(context.Background(), "tree", "learn-sample", nil); err != nil {
+		t.Fatalf("tree error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "── ServiceMonitor/learn-sample") {
+		t.Errorf("tree output misses the ServiceMonitor:\n%s", got)
+	}
+}
+
+func TestDiffPlansHTTPRouteWhenGatewayAPIServed(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Gateway = &devopsv1alpha1.GatewaySpec{
+		ParentRefs: []devopsv1alpha1.GatewayParentRef{{Name: "public", Namespace: "infra"}},
+	}
+	p, out := newPluginFor(t, learn)
+	ctx := context.Background()
+	if err := p.client.Get(ctx, types.NamespacedName{Name: "learn-sample", Namespace: "default"}, learn); err != nil {
+		t.Fatal(err)
+	}
+	learn.Spec.Gateway.Hostnames = []string{"learn.example.com"}
+	if err := p.client.Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.run(ctx, "diff", "learn-sample", nil); err != nil {
+		t.Fatalf("diff error = %v", err)
+	}
+	if got := out.String(); strings.Contains(got, "HTTPRoute") {
+		t.Errorf("diff plans the HTTPRoute of a CRD not served:\n%s", got)
+	}
+
+	out.Reset()
+	serveKind(p, httpRouteGVK)
+	if err := p.run(ctx, "diff", "learn-sample", nil); err != nil {
+		t.Fatalf("diff error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Update HTTPRoute/learn-sample") {
+		t.Errorf("diff output misses the HTTPRoute:\n%s", got)
+	}
+}
+
+func TestDiffAppliesDefaults(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Image = ""
+	// The resources were created with the built-in default image
+	p, out := newPluginFor(t, learn)
+	p.defaults = configv1alpha1.LearnDefaults{Image: "dxas90/learn:9.9.9"}
+	if err := p.run(context.Background(), "diff", "learn-sample", nil); err != nil {
+		t.Fatalf("diff error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Update Deployment/learn-sample") || !strings.Contains(got, "~ spec.template.spec.containers") {
+		t.Errorf("diff output misses the change to the default image:\n%s", got)
+	}
+}
+
+func TestLoadLearnDefaults(t *testing.T) {
+	defaults, err := loadLearnDefaults("")
+	if err != nil {
+		t.Fatalf("loadLearnDefaults() error = %v", err)
+	}
+	if defaults.Image != configv1alpha1.DefaultImage || defaults.Replicas != configv1alpha1.DefaultReplicas {
+		t.Errorf("loadLearnDefaults() = %+v, want the built-in defaults", defaults)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "apiVersion: config.devops.dxas90/v1alpha1\nkind: OperatorConfig\nlearnDefaults:\n  image: registry.example.com/learn:2.0.0\n  replicas: 3\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defaults, err = loadLearnDefaults(path)
+	if err != nil {
+		t.Fatalf("loadLearnDefaults(%s) error = %v", path, err)
+	}
+	if defaults.Image != "registry.example.com/learn:2.0.0" || defaults.Replicas != 3 || defaults.MaxReplicas != configv1alpha1.DefaultMaxReplicas {
+		t.Errorf("loadLearnDefaults(%s) = %+v, want the configured defaults completed with the built-in ones", path, defaults)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("learnDefaults:\n  unknown: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadLearnDefaults(path); err == nil {
+		t.Errorf("loadLearnDefaults() of an unknown field = nil error, want an error")
+	}
+}
+
+func TestStatusReportsHTTPRouteAcceptance(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Gateway = &devopsv1alpha1.GatewaySpec{
+		ParentRefs: []devopsv1alpha1.GatewayParentRef{{Name: "public", Namespace: "infra"}},
+	}
+	p, out := newPluginFor(t, learn)
+	serveKind(p, httpRouteGVK)
+	ctx := context.Background()
+	if err := p.run(ctx, "status", "learn-sample", nil); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+	if got := statusRow(out.String(), "HTTPRoute"); !strings.HasPrefix(got, "HTTPRoute learn-sample Progressing Waiting for Gateway infra/public") {
+		t.Errorf("status row of the HTTPRoute = %q, want it waiting for its Gateway", got)
+	}
+
+	for _, tt := range []struct {
+		accepted string
+		reason   string
+		want     string
+	}{
+		{accepted: "True", reason: "Accepted", want: "HTTPRoute learn-sample Healthy HTTPRoute learn-sample is accepted by Gateway infra/public"},
+		{accepted: "False", reason: "NotAllowedByListeners", want: "HTTPRoute learn-sample Degraded NotAllowedByListeners: Gateway infra/public: not allowed"},
+	} {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(httpRouteGVK)
+		if err := p.client.Get(ctx, types.NamespacedName{Name: "learn-sample", Namespace: "default"}, route); err != nil {
+			t.Fatal(err)
+		}
+		conditions := []interface{}{}
+		for _, conditionType := range []string{"Accepted", "ResolvedRefs"} {
+			status, reason, message := "True", conditionType, conditionType
+			if conditionType == "Accepted" {
+				status, reason, message = tt.accepted, tt.reason, "not allowed"
+			}
+			conditions = append(conditions, map[string]interface{}{
+				"type": conditionType, "status": status, "reason": reason, "message": message,
+				"lastTransitionTime": "2021-06-01T00:00:00Z",
+			})
+		}
+		route.Object["status"] = map[string]interface{}{"parents": []interface{}{map[string]interface{}{
+			"parentRef":  map[string]interface{}{"name": "public", "namespace": "infra"},
+			"conditions": conditions,
+		}}}
+		if err := p.client.Update(ctx, route); err != nil {
+			t.Fatal(err)
+		}
+
+		out.Reset()
+		if err := p.run(ctx, "status", "learn-sample", nil); err != nil {
+			t.Fatalf("status error = %v", err)
+		}
+		if got := statusRow(out.String(), "HTTPRoute"); got != tt.want {
+			t.Errorf("status row of the HTTPRoute with Accepted %s = %q, want %q", tt.accepted, got, tt.want)
+		}
+	}
+}
+
+// statusRow returns the row of kind in the output of status, its columns
+// separated by a single space
+func statusRow(output, kind string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == kind {
+			return strings.Join(fields, " ")
+		}
+	}
+	return ""
+}
+
+func TestTreeListsHTTPRoute(t *testing.T) {
+	learn := sampleLearn()
+	learn.Spec.Gateway = &devopsv1alpha1.GatewaySpec{
+		ParentRefs: []devopsv1alpha1.GatewayParentRef{{Name: "public", Namespace: "infra"}},
+	}
+	p, out := newPluginFor(t, learn)
+	serveKind(p, httpRouteGVK)
+	if err := p.run(context.Background(), "tree", "learn-sample", nil); err != nil {
+		t.Fatalf("tree error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "── HTTPRoute/learn-sample") {
+		t.Errorf("tree output misses the HTTPRoute:\n%s", got)
+	}
+}
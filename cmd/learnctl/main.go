@@ -0,0 +1,101 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command learnctl works with Learn manifests without a cluster.
+//
+//	learnctl render -f learn.yaml -o yaml
+//
+// prints the resources the operator would create for the Learn of learn.yaml.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(devopsv1alpha1.AddToScheme(scheme))
+}
+
+const usage = `learnctl works with Learn manifests without a cluster.
+
+Usage:
+  learnctl render [-f FILE] [-o yaml|json] [-n NAMESPACE]
+
+Commands:
+  render  Print the resources the operator creates for the Learns of FILE
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "learnctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the learnctl command of args
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+	switch args[0] {
+	case "render":
+		return runRender(args[1:], stdin, stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runRender parses the flags of the render command and renders its input
+func runRender(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	file := flags.String("f", "-", "The file holding the Learn manifests, - reads stdin.")
+	output := flags.String("o", "yaml", "The output format, yaml or json.")
+	namespace := flags.String("n", "", "The namespace of the Learns that do not set one.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	in := stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return render(in, stdout, renderOptions{Format: *output, Namespace: *namespace})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"github.com/dxas90/learn-operator/controllers"
+)
+
+// renderOptions are the options of the render command
+type renderOptions struct {
+	// Format is yaml or json
+	Format string
+	// Namespace is set on the Learns that do not set one
+	Namespace string
+}
+
+// render prints to out the resources the operator creates for every Learn of
+// in, a stream of YAML or JSON documents. YAML is printed as one document per
+// resource, JSON as a v1 List.
+func render(in io.Reader, out io.Writer, opts renderOptions) error {
+	if opts.Format != "yaml" && opts.Format != "json" {
+		return fmt.Errorf("unknown output format %q, use yaml or json", opts.Format)
+	}
+	learns, err := decodeLearns(in)
+	if err != nil {
+		return err
+	}
+
+	var items []map[string]interface{}
+	for _, learn := range learns {
+		if learn.Namespace == "" {
+			learn.Namespace = opts.Namespace
+		}
+		for _, obj := range controllers.RenderLearn(learn, configv1alpha1.LearnDefaults{}, scheme) {
+			item, err := toManifest(obj)
+			if err != nil {
+				return fmt.Errorf("rendering Learn %s: %w", learn.Name, err)
+			}
+			items = append(items, item)
+		}
+	}
+
+	if opts.Format == "json" {
+		list := map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items}
+		content, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", content)
+		return err
+	}
+	for _, item := range items {
+		content, err := yaml.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeLearns reads the Learns of in, any other kind is an error
+func decodeLearns(in io.Reader) ([]*devopsv1alpha1.Learn, error) {
+	var learns []*devopsv1alpha1.Learn
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	for {
+		doc := &unstructured.Unstructured{}
+		if err := decoder.Decode(&doc.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(doc.Object) == 0 {
+			// An empty document, such as the one after a trailing ---
+			continue
+		}
+		if gvk := doc.GroupVersionKind(); gvk != devopsv1alpha1.GroupVersion.WithKind("Learn") {
+			return nil, fmt.Errorf("%s %s is not a %s Learn", gvk.Kind, doc.GetName(), devopsv1alpha1.GroupVersion)
+		}
+		learn := &devopsv1alpha1.Learn{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(doc.Object, learn); err != nil {
+			return nil, fmt.Errorf("decoding Learn %s: %w", doc.GetName(), err)
+		}
+		learns = append(learns, learn)
+	}
+	if len(learns) == 0 {
+		return nil, fmt.Errorf("no Learn found in the input")
+	}
+	return learns, nil
+}
+
+// toManifest returns obj as a manifest that can be applied to a cluster. The
+// owner references are removed since the Learn has no UID outside a cluster,
+// as are the fields the API server fills in.
+func toManifest(obj runtime.Object) (map[string]interface{}, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	u.SetOwnerReferences(nil)
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u.Object, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const learnManifest = `apiVersion: devops.dxas90/v1alpha1
+kind: Learn
+metadata:
+  name: learn-sample
+spec:
+  replicas: 2
+  image: dxas90/learn:1.0.0
+---
+`
+
+func TestRenderYAML(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"render", "-n", "demo"}, strings.NewReader(learnManifest), &out); err != nil {
+		t.Fatalf("render error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"kind: ConfigMap", "kind: ServiceAccount", "kind: Deployment", "kind: Service", "kind: HorizontalPodAutoscaler",
+		"namespace: demo", "image: dxas90/learn:1.0.0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("render output misses %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"ownerReferences", "creationTimestamp", "status:"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("render output holds %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	manifest := strings.Replace(learnManifest, "  replicas: 2\n", "  replicas: 2\n  autoscaling:\n    enabled: false\n", 1)
+	var out bytes.Buffer
+	if err := run([]string{"render", "-o", "json"}, strings.NewReader(manifest), &out); err != nil {
+		t.Fatalf("render error = %v", err)
+	}
+	var list struct {
+		Kind  string `json:"kind"`
+		Items []struct {
+			Kind string `json:"kind"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("render output is not JSON: %v", err)
+	}
+	var kinds []string
+	for _, item := range list.Items {
+		kinds = append(kinds, item.Kind)
+	}
+	if list.Kind != "List" || strings.Join(kinds, ",") != "ConfigMap,ServiceAccount,Deployment,Service" {
+		t.Errorf("render output = %s of %v, want a List without the HorizontalPodAutoscaler", list.Kind, kinds)
+	}
+}
+
+func TestRenderRejectsOtherKinds(t *testing.T) {
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: other\n"
+	if err := run([]string{"render"}, strings.NewReader(manifest), &bytes.Buffer{}); err == nil {
+		t.Error("render of a ConfigMap succeeded, want an error")
+	}
+}
+
+func TestRenderMonitoringAndGateway(t *testing.T) {
+	manifest := strings.Replace(learnManifest, "  replicas: 2\n",
+		"  replicas: 2\n  monitoring:\n    enabled: true\n  gateway:\n    parentRefs:\n    - name: public\n", 1)
+	var out bytes.Buffer
+	if err := run([]string{"render", "-o", "json"}, strings.NewReader(manifest), &out); err != nil {
+		t.Fatalf("render error = %v", err)
+	}
+	var list struct {
+		Items []struct {
+			Kind string `json:"kind"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("render output is not JSON: %v", err)
+	}
+	var kinds []string
+	for _, item := range list.Items {
+		kinds = append(kinds, item.Kind)
+	}
+	if got, want := strings.Join(kinds, ","), "ConfigMap,ServiceAccount,Deployment,Service,HorizontalPodAutoscaler,ServiceMonitor,HTTPRoute"; got != want {
+		t.Errorf("render output kinds = %s, want %s", got, want)
+	}
+}
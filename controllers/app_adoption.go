@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ReasonAdopted is recorded when an existing resource is taken over by its owner
+const ReasonAdopted = "Adopted"
+
+// NotOwnedError is returned for an existing resource named like one of an
+// owner that the owner does not control and may not take over
+type NotOwnedError struct {
+	Kind string
+	Name string
+	// Policy is the adoption policy of the owner, empty when the error comes
+	// from a write refused on a resource the owner does not control
+	Policy devopsv1alpha1.AdoptionPolicy
+	// Controller is the kind/name of the controller of the resource, empty
+	// when it has none
+	Controller string
+}
+
+func (e *NotOwnedError) Error() string {
+	if e.Controller != "" {
+		return fmt.Sprintf("%s %s exists and is controlled by %s", e.Kind, e.Name, e.Controller)
+	}
+	if e.Policy == "" {
+		return fmt.Sprintf("%s %s is not controlled by its owner", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%s %s exists and the adoption policy %s does not allow to take it over", e.Kind, e.Name, e.Policy)
+}
+
+// adopt makes sure existing, found under the name of a resource of owner, is
+// controlled by owner. A resource without a controller is taken over when the
+// adoption policy of owner allows it, one controlled by another object never is.
+func (c ownedClient) adopt(ctx context.Context, owner devopsv1alpha1.AppWorkload, existing client.Object) error {
+	if metav1.IsControlledBy(existing, owner) {
+		return nil
+	}
+	policy := owner.AppAdoptionPolicy()
+	notOwned := &NotOwnedError{Kind: c.kindOf(existing), Name: existing.GetName(), Policy: policy}
+	if ref := metav1.GetControllerOf(existing); ref != nil {
+		notOwned.Controller = ref.Kind + "/" + ref.Name
+		return notOwned
+	}
+	switch policy {
+	case devopsv1alpha1.AdoptAlways:
+	case devopsv1alpha1.AdoptIfLabeled:
+		if existing.GetLabels()[devopsv1alpha1.LabelAdoptable] != "true" {
+			return notOwned
+		}
+	default:
+		return notOwned
+	}
+
+	if err := controllerutil.SetControllerReference(owner, existing, c.scheme); err != nil {
+		return err
+	}
+	// The ownership label lets the prune remove it once the owner no longer asks for it
+	setOwnedByLabel(owner, existing)
+	if err := c.Update(ctx, existing); err != nil {
+		return resourceError("update", notOwned.Kind, existing.GetName(), err)
+	}
+	c.recordEvent(owner, existing, ReasonAdopted)
+	return nil
+}
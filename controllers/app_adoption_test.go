@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// foreignService returns a Service named like the learn-sample Learn that it
+// does not control
+func foreignService(labels map[string]string, controller *metav1.OwnerReference) *corev1.Service {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", Labels: labels}}
+	if controller != nil {
+		svc.OwnerReferences = []metav1.OwnerReference{*controller}
+	}
+	return svc
+}
+
+func TestEnsureCreatedAdoption(t *testing.T) {
+	isController := true
+	otherController := &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other-team", UID: "other-uid", Controller: &isController}
+	adoptable := map[string]string{devopsv1alpha1.LabelAdoptable: "true"}
+
+	for _, tt := range []struct {
+		name      string
+		policy    devopsv1alpha1.AdoptionPolicy
+		existing  *corev1.Service
+		wantAdopt bool
+	}{
+		{"Never", devopsv1alpha1.AdoptNever, foreignService(adoptable, nil), false},
+		{"IfLabeled without the label", devopsv1alpha1.AdoptIfLabeled, foreignService(nil, nil), false},
+		{"IfLabeled with the label", devopsv1alpha1.AdoptIfLabeled, foreignService(adoptable, nil), true},
+		{"Always", devopsv1alpha1.AdoptAlways, foreignService(nil, nil), true},
+		{"Always with another controller", devopsv1alpha1.AdoptAlways, foreignService(nil, otherController), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			learn := &devopsv1alpha1.Learn{
+				ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+				Spec:       devopsv1alpha1.LearnSpec{AdoptionPolicy: tt.policy},
+			}
+			r := newFakeReconciler(learn, tt.existing)
+			ctx := context.Background()
+
+			err := r.createServiceCR(ctx, learn)
+			svc := &corev1.Service{}
+			if getErr := r.Get(ctx, types.NamespacedName{Name: "learn-sample", Namespace: "default"}, svc); getErr != nil {
+				t.Fatal(getErr)
+			}
+			if tt.wantAdopt {
+				if err != nil {
+					t.Fatalf("createServiceCR() error = %v", err)
+				}
+				if !metav1.IsControlledBy(svc, learn) || svc.Labels[devopsv1alpha1.LabelOwnedBy] != string(learn.UID) {
+					t.Errorf("Service not adopted, owners = %v, labels = %v", svc.OwnerReferences, svc.Labels)
+				}
+				return
+			}
+			var notOwned *NotOwnedError
+			if !goerrors.As(err, &notOwned) {
+				t.Fatalf("createServiceCR() error = %v, want a NotOwnedError", err)
+			}
+			if metav1.IsControlledBy(svc, learn) || svc.Labels[devopsv1alpha1.LabelOwnedBy] != "" {
+				t.Errorf("Service taken over, owners = %v, labels = %v", svc.OwnerReferences, svc.Labels)
+			}
+		})
+	}
+}
+
+func TestReconcileReportsConflict(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+	r := newFakeReconciler(learn, foreignService(nil, nil))
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil || result.RequeueAfter != persistentErrorBackoff {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue after %v", result, err, persistentErrorBackoff)
+	}
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(live.Status.Conditions, devopsv1alpha1.ConditionConflict) {
+		t.Errorf("conditions = %+v, want Conflict True", live.Status.Conditions)
+	}
+
+	// Labelling the Service and allowing it resolves the conflict
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	svc.Labels = map[string]string{devopsv1alpha1.LabelAdoptable: "true"}
+	if err := r.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	live.Spec.AdoptionPolicy = devopsv1alpha1.AdoptIfLabeled
+	if err := r.Update(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionConflict) != nil {
+		t.Errorf("conditions = %+v, want no Conflict", live.Status.Conditions)
+	}
+}
+
+func TestStatusCopiesOnlyControlledResources(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		controlled bool
+	}{
+		{"foreign", false},
+		{"controlled", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			learn := &devopsv1alpha1.Learn{
+				ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+				Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0"},
+			}
+			var controller *metav1.OwnerReference
+			if tt.controlled {
+				controller = metav1.NewControllerRef(learn, devopsv1alpha1.GroupVersion.WithKind("Learn"))
+			}
+			svc := foreignService(nil, controller)
+			svc.Spec.Ports = []corev1.ServicePort{{Name: "web", Port: 8080}}
+			svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+			dep := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default"},
+				Status:     appsv1.DeploymentStatus{Replicas: 3, ReadyReplicas: 3},
+			}
+			if controller != nil {
+				dep.OwnerReferences = []metav1.OwnerReference{*controller}
+			}
+			r := newFakeReconciler(learn, svc, dep)
+			key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+			if err := r.createUpdateCRStatus(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("createUpdateCRStatus() error = %v", err)
+			}
+			got := getLearn(t, r, key)
+			if copied := got.Status.DeploymentStatus.ReadyReplicas == 3; copied != tt.controlled {
+				t.Errorf("status.deploymentStatus = %+v, want it copied only from a controlled Deployment", got.Status.DeploymentStatus)
+			}
+			if copied := len(got.Status.ServiceStatus.LoadBalancer.Ingress) > 0 && len(got.Status.Endpoints) > 0; copied != tt.controlled {
+				t.Errorf("status.serviceStatus = %+v, endpoints = %+v, want them copied only from a controlled Service", got.Status.ServiceStatus, got.Status.Endpoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,760 @@
+package controllers
+
+import (
+	"strings"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// managedBy is the app.kubernetes.io/managed-by label of the resources of the operator
+const managedBy = "learn-operator"
+
+// appLabels returns the labels set on every resource and pod of the app since
+// the first versions of the operator. The Service selects on them so it spans
+// the pods of every Deployment of the app, and the Deployments created before
+// selectorLabels keep selecting on them.
+func appLabels(cr devopsv1alpha1.AppWorkload) map[string]string {
+	return map[string]string{
+		"app":    cr.GetName(),
+		"devops": cr.GetName(),
+	}
+}
+
+// selectorLabels returns the labels a new Deployment of the app selects its pods on
+func selectorLabels(cr devopsv1alpha1.AppWorkload) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     cr.AppName(),
+		"app.kubernetes.io/instance": cr.GetName(),
+	}
+}
+
+// podLabels returns the labels of the pods of the app: the common labels of
+// the app, overridden by appLabels, selectorLabels and the managed-by label
+func podLabels(cr devopsv1alpha1.AppWorkload) map[string]string {
+	labels := map[string]string{}
+	for _, set := range []map[string]string{cr.AppCommonMetadata().Labels, appLabels(cr), selectorLabels(cr)} {
+		for k, v := range set {
+			labels[k] = v
+		}
+	}
+	labels["app.kubernetes.io/managed-by"] = managedBy
+	return labels
+}
+
+// resourceLabels returns the labels of the resources of the app, the labels
+// of its pods and the version of the app. The pods leave the version out, so
+// a new image changes their template once.
+func resourceLabels(cr devopsv1alpha1.AppWorkload) map[string]string {
+	labels := podLabels(cr)
+	if version := imageVersion(cr.AppImage()); version != "" {
+		labels["app.kubernetes.io/version"] = version
+	}
+	return labels
+}
+
+// resourceAnnotations returns the annotations of the resources and pods of
+// the app, nil when it has none
+func resourceAnnotations(cr devopsv1alpha1.AppWorkload) map[string]string {
+	common := cr.AppCommonMetadata().Annotations
+	if len(common) == 0 {
+		return nil
+	}
+	annotations := make(map[string]string, len(common))
+	for k, v := range common {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// imageVersion returns the tag of image, empty when it has none or the tag
+// is not a valid label value
+func imageVersion(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	tag := image[i+1:]
+	if len(validation.IsValidLabelValue(tag)) > 0 {
+		return ""
+	}
+	return tag
+}
+
+// NewConfigMapCR returns the ConfigMap the pods of the app mount, holding Data
+func NewConfigMapCR(cr devopsv1alpha1.AppWorkload, Data map[string]string, scheme *runtime.Scheme) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cr.AppPodOptions().ConfigMapName,
+			Namespace:   cr.GetNamespace(),
+			Labels:      resourceLabels(cr),
+			Annotations: resourceAnnotations(cr),
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		Data: Data,
+	}
+	controllerutil.SetControllerReference(cr, configMap, scheme)
+	return configMap
+}
+
+// Returns the service object for the app, exposed as its service spec asks
+func NewService(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *corev1.Service {
+	spec := cr.AppService()
+	if spec == nil {
+		spec = &devopsv1alpha1.ServiceSpec{}
+	}
+	annotations := resourceAnnotations(cr)
+	if len(spec.Annotations) > 0 && annotations == nil {
+		annotations = make(map[string]string, len(spec.Annotations))
+	}
+	for k, v := range spec.Annotations {
+		annotations[k] = v
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cr.AppName(),
+			Namespace:   cr.GetNamespace(),
+			Labels:      resourceLabels(cr),
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector:        appLabels(cr),
+			Type:            corev1.ServiceTypeClusterIP,
+			Ports:           declaredPorts(cr),
+			SessionAffinity: corev1.ServiceAffinityNone,
+		},
+	}
+	// Expose the metrics port scraped by the ServiceMonitor
+	if port := metricsPort(cr); port != nil {
+		service.Spec.Ports = append(service.Spec.Ports, *port)
+	}
+
+	switch spec.Type {
+	case devopsv1alpha1.ServiceHeadless:
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+	case devopsv1alpha1.ServiceNodePort, devopsv1alpha1.ServiceLoadBalancer:
+		service.Spec.Type = corev1.ServiceType(spec.Type)
+		// The API server defaults the policy, set it so the Service does not drift
+		service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeCluster
+		if spec.ExternalTrafficPolicy != "" {
+			service.Spec.ExternalTrafficPolicy = spec.ExternalTrafficPolicy
+		}
+		if spec.Type == devopsv1alpha1.ServiceLoadBalancer {
+			service.Spec.LoadBalancerSourceRanges = spec.LoadBalancerSourceRanges
+		}
+	}
+	// Only the Services reachable on the nodes have node ports
+	if service.Spec.Type == corev1.ServiceTypeClusterIP {
+		for i := range service.Spec.Ports {
+			service.Spec.Ports[i].NodePort = 0
+		}
+	}
+
+	if spec.SessionAffinity == corev1.ServiceAffinityClientIP {
+		timeout := spec.SessionAffinityTimeoutSeconds
+		if timeout == 0 {
+			timeout = corev1.DefaultClientIPServiceAffinitySeconds
+		}
+		service.Spec.SessionAffinity = corev1.ServiceAffinityClientIP
+		service.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{
+			ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &timeout},
+		}
+	}
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, service, scheme)
+	return service
+}
+
+// declaredPorts returns the ports of the service spec of the app, the web
+// port 8080 when it declares none
+func declaredPorts(cr devopsv1alpha1.AppWorkload) []corev1.ServicePort {
+	spec := cr.AppService()
+	if spec == nil || len(spec.Ports) == 0 {
+		return []corev1.ServicePort{
+			{
+				Name: "web",
+				TargetPort: intstr.IntOrString{
+					Type:   intstr.Int,
+					IntVal: 8080,
+				},
+				Port:     8080,
+				Protocol: "TCP",
+			},
+		}
+	}
+	ports := make([]corev1.ServicePort, 0, len(spec.Ports))
+	for _, port := range spec.Ports {
+		targetPort := intstr.FromInt(int(port.Port))
+		if port.TargetPort != nil {
+			targetPort = *port.TargetPort
+		}
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		ports = append(ports, corev1.ServicePort{
+			Name:       port.Name,
+			TargetPort: targetPort,
+			Port:       port.Port,
+			Protocol:   protocol,
+			NodePort:   port.NodePort,
+		})
+	}
+	return ports
+}
+
+// NewDeploymentForCR returns a deployment name/namespace as the cr
+func NewDeploymentForCR(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *appsv1.Deployment {
+	options := cr.AppPodOptions()
+	replicas := cr.AppReplicas()
+	var defaultMode int32 = 0755
+	var defaultFSGroup int64 = 65534
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   cr.GetNamespace(),
+			Name:        cr.AppName(),
+			Labels:      resourceLabels(cr),
+			Annotations: resourceAnnotations(cr),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selectorLabels(cr),
+			},
+			Replicas: &replicas,
+			Strategy: appsv1.DeploymentStrategy{
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &intstr.IntOrString{
+						Type:   intstr.Int,
+						IntVal: 0,
+					},
+					MaxSurge: &intstr.IntOrString{
+						Type:   intstr.Int,
+						IntVal: 2,
+					},
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      podLabels(cr),
+					Annotations: resourceAnnotations(cr),
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: options.ConfigMapName,
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: options.ConfigMapName,
+									},
+									DefaultMode: &defaultMode,
+								},
+							},
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:            "pull-secrets",
+							Image:           "busybox",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									ConfigMapRef: &corev1.ConfigMapEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: options.ConfigMapName,
+										},
+									},
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "POD_IP",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "status.podIP",
+										},
+									},
+								},
+								{
+									Name: "POD_NAMESPACE",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "metadata.namespace",
+										},
+									},
+								},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("5m"),
+									corev1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("5m"),
+									corev1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            cr.AppName(),
+							Image:           cr.AppImage(),
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "web",
+									ContainerPort: 8080,
+									Protocol:      "TCP",
+								},
+							},
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									ConfigMapRef: &corev1.ConfigMapEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: options.ConfigMapName,
+										},
+									},
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "POD_IP",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "status.podIP",
+										},
+									},
+								},
+								{
+									Name: "POD_NAME",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "metadata.name",
+										},
+									},
+								},
+								{
+									Name: "MY_NAMESPACE",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "metadata.namespace",
+										},
+									},
+								},
+								{
+									Name: "USER",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "metadata.name",
+										},
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      options.ConfigMapName,
+									MountPath: "/conf",
+									ReadOnly:  true,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path: "/healthz",
+										Port: intstr.IntOrString{
+											Type:   intstr.String,
+											StrVal: "web",
+										},
+									},
+								},
+								InitialDelaySeconds: 3,
+								TimeoutSeconds:      2,
+								FailureThreshold:    5,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("48Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("48Mi"),
+								},
+							},
+							TerminationMessagePath:   "/dev/termination-log",
+							TerminationMessagePolicy: "File",
+						},
+					},
+					DNSPolicy:     corev1.DNSClusterFirst,
+					RestartPolicy: corev1.RestartPolicyAlways,
+					SecurityContext: &corev1.PodSecurityContext{
+						FSGroup: &defaultFSGroup,
+					},
+					ServiceAccountName: options.ServiceAccountName,
+				},
+			},
+		},
+	}
+	controllerutil.SetControllerReference(cr, deployment, scheme)
+	return deployment
+}
+
+// Returns the ServiceAccount object for the app
+func NewServiceAccount(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *corev1.ServiceAccount {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cr.AppPodOptions().ServiceAccountName,
+			Namespace:   cr.GetNamespace(),
+			Labels:      resourceLabels(cr),
+			Annotations: resourceAnnotations(cr),
+		},
+	}
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, serviceAccount, scheme)
+	return serviceAccount
+}
+
+// Returns the HorizontalPodAutoscaler object for the app
+func NewHorizontalPodAutoscalerForCR(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	MinReplicas := configv1alpha1.DefaultMinReplicas
+	MaxReplicas := configv1alpha1.DefaultMaxReplicas
+	if autoscaling := cr.AppAutoscaling(); autoscaling != nil {
+		if autoscaling.MinReplicas != 0 {
+			MinReplicas = autoscaling.MinReplicas
+		}
+		if autoscaling.MaxReplicas != 0 {
+			MaxReplicas = autoscaling.MaxReplicas
+		}
+	}
+	if MaxReplicas < MinReplicas {
+		MaxReplicas = MinReplicas
+	}
+	var averageCPUUtilization int32 = 80
+	var averageMemoryValue int64 = 50
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cr.AppName(),
+			Namespace:   cr.GetNamespace(),
+			Labels:      resourceLabels(cr),
+			Annotations: resourceAnnotations(cr),
+		}, Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				Kind:       "Deployment",
+				APIVersion: "apps/v1",
+				Name:       cr.AppName(),
+			},
+			MinReplicas: &MinReplicas,
+			MaxReplicas: MaxReplicas,
+			Metrics: []autoscalingv2beta2.MetricSpec{
+				{
+					Type: "Resource",
+					Resource: &autoscalingv2beta2.ResourceMetricSource{
+						Name: "cpu",
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:               autoscalingv2beta2.UtilizationMetricType,
+							AverageUtilization: &averageCPUUtilization,
+						},
+					},
+				},
+				{
+					Type: "Resource",
+					Resource: &autoscalingv2beta2.ResourceMetricSource{
+						Name: "memory",
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:         autoscalingv2beta2.AverageValueMetricType,
+							AverageValue: resource.NewQuantity(averageMemoryValue, resource.MustParse("Mi").Format),
+						},
+					},
+				},
+			},
+		},
+	}
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, hpa, scheme)
+	return hpa
+}
+
+// NewServiceMonitor returns the monitoring.coreos.com/v1 ServiceMonitor scraping the app
+func NewServiceMonitor(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *unstructured.Unstructured {
+	smLabels := map[string]interface{}{}
+	monitoring := cr.AppMonitoring()
+	for k, v := range monitoring.Labels {
+		smLabels[k] = v
+	}
+	for k, v := range resourceLabels(cr) {
+		smLabels[k] = v
+	}
+	// The Service is selected on the labels it has always had
+	selector := map[string]interface{}{}
+	for k, v := range appLabels(cr) {
+		selector[k] = v
+	}
+
+	endpoint := map[string]interface{}{
+		"port": metricsPortName(cr),
+		"path": monitoring.Path,
+	}
+	if endpoint["path"] == "" {
+		endpoint["path"] = "/metrics"
+	}
+	if monitoring.Interval != "" {
+		endpoint["interval"] = monitoring.Interval
+	}
+
+	sm := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      cr.AppName(),
+			"namespace": cr.GetNamespace(),
+			"labels":    smLabels,
+		},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": selector,
+			},
+			"endpoints": []interface{}{endpoint},
+		},
+	}}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetAnnotations(resourceAnnotations(cr))
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, sm, scheme)
+	return sm
+}
+
+// NewHTTPRoute returns the gateway.networking.k8s.io/v1 HTTPRoute routing the
+// Gateways of the app to its Service. The defaults of the API server are
+// filled in so the route does not drift from the live one.
+func NewHTTPRoute(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) *unstructured.Unstructured {
+	gateway := cr.AppGateway()
+	parentRefs := make([]interface{}, 0, len(gateway.ParentRefs))
+	for _, ref := range gateway.ParentRefs {
+		parentRef := map[string]interface{}{
+			"group": httpRouteGVK.Group,
+			"kind":  "Gateway",
+			"name":  ref.Name,
+		}
+		if ref.Namespace != "" {
+			parentRef["namespace"] = ref.Namespace
+		}
+		if ref.SectionName != "" {
+			parentRef["sectionName"] = ref.SectionName
+		}
+		parentRefs = append(parentRefs, parentRef)
+	}
+
+	rules := gateway.Rules
+	if len(rules) == 0 {
+		rules = []devopsv1alpha1.RouteRule{{}}
+	}
+	routeRules := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		routeRules = append(routeRules, httpRouteRule(cr, rule))
+	}
+
+	spec := map[string]interface{}{
+		"parentRefs": parentRefs,
+		"rules":      routeRules,
+	}
+	if len(gateway.Hostnames) > 0 {
+		hostnames := make([]interface{}, 0, len(gateway.Hostnames))
+		for _, hostname := range gateway.Hostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		spec["hostnames"] = hostnames
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      cr.AppName(),
+			"namespace": cr.GetNamespace(),
+		},
+		"spec": spec,
+	}}
+	route.SetGroupVersionKind(httpRouteGVK)
+	route.SetLabels(resourceLabels(cr))
+	route.SetAnnotations(resourceAnnotations(cr))
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, route, scheme)
+	return route
+}
+
+// httpRouteRule returns rule in the form of the HTTPRoute, its empty matches
+// and backends replaced by the prefix / and the Service of the app
+func httpRouteRule(cr devopsv1alpha1.AppWorkload, rule devopsv1alpha1.RouteRule) map[string]interface{} {
+	matches := rule.Matches
+	if len(matches) == 0 {
+		matches = []devopsv1alpha1.RouteMatch{{}}
+	}
+	routeMatches := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		path := map[string]interface{}{"type": "PathPrefix", "value": "/"}
+		if match.Path != nil {
+			if match.Path.Type != "" {
+				path["type"] = match.Path.Type
+			}
+			if match.Path.Value != "" {
+				path["value"] = match.Path.Value
+			}
+		}
+		routeMatch := map[string]interface{}{"path": path}
+		if len(match.Headers) > 0 {
+			headers := make([]interface{}, 0, len(match.Headers))
+			for _, header := range match.Headers {
+				headerType := header.Type
+				if headerType == "" {
+					headerType = "Exact"
+				}
+				headers = append(headers, map[string]interface{}{
+					"type":  headerType,
+					"name":  header.Name,
+					"value": header.Value,
+				})
+			}
+			routeMatch["headers"] = headers
+		}
+		routeMatches = append(routeMatches, routeMatch)
+	}
+
+	backends := rule.BackendRefs
+	if len(backends) == 0 {
+		backends = []devopsv1alpha1.RouteBackendRef{{}}
+	}
+	backendRefs := make([]interface{}, 0, len(backends))
+	for _, backend := range backends {
+		name := backend.Name
+		if name == "" {
+			name = cr.AppName()
+		}
+		port := backend.Port
+		if port == 0 {
+			port = declaredPorts(cr)[0].Port
+		}
+		var weight int32 = 1
+		if backend.Weight != nil {
+			weight = *backend.Weight
+		}
+		backendRefs = append(backendRefs, map[string]interface{}{
+			"group":  "",
+			"kind":   "Service",
+			"name":   name,
+			"port":   int64(port),
+			"weight": int64(weight),
+		})
+	}
+
+	routeRule := map[string]interface{}{
+		"matches":     routeMatches,
+		"backendRefs": backendRefs,
+	}
+	if rule.Timeout != "" {
+		routeRule["timeouts"] = map[string]interface{}{"request": rule.Timeout}
+	}
+	return routeRule
+}
+
+// gatewayEnabled returns true when the app asks for an HTTPRoute
+func gatewayEnabled(cr devopsv1alpha1.AppWorkload) bool {
+	return cr.AppGateway() != nil
+}
+
+// monitoringEnabled returns true when the app asks for a ServiceMonitor
+func monitoringEnabled(cr devopsv1alpha1.AppWorkload) bool {
+	monitoring := cr.AppMonitoring()
+	return monitoring != nil && monitoring.Enabled
+}
+
+// metricsPortName returns the name of the Service port the ServiceMonitor
+// scrapes, the declared metrics port when there is one
+func metricsPortName(cr devopsv1alpha1.AppWorkload) string {
+	if port := metricsPort(cr); port != nil {
+		return port.Name
+	}
+	if port := declaredMetricsPort(cr); port != nil {
+		return port.Name
+	}
+	return declaredPorts(cr)[0].Name
+}
+
+// declaredMetricsPort returns the declared port serving the app metrics: the
+// one targeting the metrics port, else the one named metrics. Nil when the
+// spec declares neither.
+func declaredMetricsPort(cr devopsv1alpha1.AppWorkload) *corev1.ServicePort {
+	number := metricsPortNumber(cr)
+	ports := declaredPorts(cr)
+	for i := range ports {
+		if ports[i].TargetPort.Type == intstr.Int && ports[i].TargetPort.IntVal == number {
+			return &ports[i]
+		}
+	}
+	for i := range ports {
+		if ports[i].Name == metricsPortDefaultName {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+// metricsPortNumber returns the port the app serves its metrics on
+func metricsPortNumber(cr devopsv1alpha1.AppWorkload) int32 {
+	if monitoring := cr.AppMonitoring(); monitoring != nil && monitoring.Port != 0 {
+		return monitoring.Port
+	}
+	return 9090
+}
+
+// metricsPortDefaultName is the name of the Service port added for the metrics
+const metricsPortDefaultName = "metrics"
+
+// metricsPort returns the extra Service port serving the app metrics, nil when
+// monitoring is disabled or one of the declared ports serves them. A declared
+// port named metrics is taken as the metrics port rather than duplicated, the
+// names of the ports of a Service are unique. So are their numbers: when a
+// declared port already has the number of the metrics port and targets another
+// one, the extra port takes the next free number.
+func metricsPort(cr devopsv1alpha1.AppWorkload) *corev1.ServicePort {
+	if !monitoringEnabled(cr) || declaredMetricsPort(cr) != nil {
+		return nil
+	}
+	target := metricsPortNumber(cr)
+	taken := map[int32]bool{}
+	for _, declared := range declaredPorts(cr) {
+		taken[declared.Port] = true
+	}
+	port := target
+	for taken[port] {
+		// Wrap around below the highest port number
+		port = port%65535 + 1
+	}
+	return &corev1.ServicePort{
+		Name: metricsPortDefaultName,
+		TargetPort: intstr.IntOrString{
+			Type:   intstr.Int,
+			IntVal: target,
+		},
+		Port:     port,
+		Protocol: "TCP",
+	}
+}
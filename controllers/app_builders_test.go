@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// update rewrites the golden files with the output of the builders:
+//
+//	go test ./controllers -run TestBuildersGolden -update
+var update = flag.Bool("update", false, "Rewrite the golden files of the builder tests.")
+
+// TestBuildersGolden builds the resources of every Learn fixture of
+// testdata/builders, named <case>.learn.yaml, and compares them with
+// <case>.golden.yaml
+func TestBuildersGolden(t *testing.T) {
+	s := runtime.NewScheme()
+	utilruntime.Must(scheme.AddToScheme(s))
+	utilruntime.Must(devopsv1alpha1.AddToScheme(s))
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "builders", "*.learn.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixture found in testdata/builders")
+	}
+	for _, fixture := range fixtures {
+		fixture := fixture
+		name := strings.TrimSuffix(filepath.Base(fixture), ".learn.yaml")
+		t.Run(name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr := &devopsv1alpha1.Learn{}
+			if err := yaml.UnmarshalStrict(content, cr); err != nil {
+				t.Fatalf("decoding %s: %v", fixture, err)
+			}
+			got, err := marshalResources(RenderLearn(cr, configv1alpha1.LearnDefaults{}, s), s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "builders", name+".golden.yaml")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run the test with -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("the resources built for %s differ from %s, run the test with -update if the change is intended:\n%s",
+					fixture, golden, got)
+			}
+		})
+	}
+}
+
+// marshalResources returns the YAML documents of resources, with their kind
+func marshalResources(resources []client.Object, s *runtime.Scheme) ([]byte, error) {
+	var out bytes.Buffer
+	for _, obj := range resources {
+		gvk, err := apiutil.GVKForObject(obj, s)
+		if err != nil {
+			return nil, err
+		}
+		obj = obj.DeepCopyObject().(client.Object)
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		content, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		out.Write(content)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// externalDNSHostnameAnnotation lists the hostnames external-dns publishes for a Service
+const externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+// serviceEndpoints returns the URLs svc is reachable at, one per port of each
+// of its addresses: its in-cluster DNS name, the external IPs of its spec, the
+// ingress points of its load balancer and the hostnames external-dns publishes.
+// The node ports are left out, the operator does not know which nodes are reachable.
+func serviceEndpoints(svc *corev1.Service) []devopsv1alpha1.Endpoint {
+	type address struct {
+		host     string
+		external bool
+	}
+	addresses := []address{{host: svc.Name + "." + svc.Namespace + ".svc"}}
+	for _, ip := range svc.Spec.ExternalIPs {
+		addresses = append(addresses, address{host: ip, external: true})
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		host := ingress.IP
+		if host == "" {
+			host = ingress.Hostname
+		}
+		if host != "" {
+			addresses = append(addresses, address{host: host, external: true})
+		}
+	}
+	for _, hostname := range strings.Split(svc.Annotations[externalDNSHostnameAnnotation], ",") {
+		if hostname = strings.TrimSpace(hostname); hostname != "" {
+			addresses = append(addresses, address{host: hostname, external: true})
+		}
+	}
+
+	var endpoints []devopsv1alpha1.Endpoint
+	for _, addr := range addresses {
+		for _, port := range svc.Spec.Ports {
+			endpoints = append(endpoints, devopsv1alpha1.Endpoint{
+				Port:     port.Name,
+				URL:      endpointURL(addr.host, port),
+				External: addr.external,
+			})
+		}
+	}
+	return endpoints
+}
+
+// endpointURL returns the URL of port on host. The scheme is https for a port
+// named https or listening on 443, the protocol for UDP and SCTP and http
+// otherwise. The default port of http and https is left out.
+func endpointURL(host string, port corev1.ServicePort) string {
+	scheme := "http"
+	switch {
+	case port.Protocol == corev1.ProtocolUDP || port.Protocol == corev1.ProtocolSCTP:
+		scheme = strings.ToLower(string(port.Protocol))
+	case port.Name == "https" || strings.HasPrefix(port.Name, "https-") || port.Port == 443:
+		scheme = "https"
+	}
+	if (scheme == "http" && port.Port == 80) || (scheme == "https" && port.Port == 443) {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(port.Port)))
+}
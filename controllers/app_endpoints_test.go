@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceEndpoints(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "learn-sample",
+			Namespace:   "apps",
+			Annotations: map[string]string{externalDNSHostnameAnnotation: "learn.example.com, www.example.com"},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
+				{Name: "web", Port: 8080, Protocol: corev1.ProtocolTCP},
+				{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+			},
+		},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{
+			{IP: "2001:db8::1"},
+			{Hostname: "lb.example.net"},
+		}}},
+	}
+
+	var got []string
+	for _, endpoint := range serviceEndpoints(svc) {
+		if endpoint.Port == "web" {
+			got = append(got, endpoint.URL)
+		}
+		// Only the in-cluster DNS name is internal
+		if endpoint.External == strings.Contains(endpoint.URL, ".svc") {
+			t.Errorf("endpoint %+v has the wrong external flag", endpoint)
+		}
+	}
+	want := []string{
+		"http://learn-sample.apps.svc:8080",
+		"http://[2001:db8::1]:8080",
+		"http://lb.example.net:8080",
+		"http://learn.example.com:8080",
+		"http://www.example.com:8080",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("web endpoints = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("web endpoints = %v, want %v", got, want)
+			break
+		}
+	}
+
+	for port, want := range map[corev1.ServicePort]string{
+		{Name: "https", Port: 443}:                                "https://[2001:db8::1]",
+		{Name: "https-admin", Port: 8443}:                         "https://[2001:db8::1]:8443",
+		{Name: "http", Port: 80}:                                  "http://[2001:db8::1]",
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP}:     "udp://[2001:db8::1]:53",
+		{Name: "sctp", Port: 9000, Protocol: corev1.ProtocolSCTP}: "sctp://[2001:db8::1]:9000",
+	} {
+		if got := endpointURL("2001:db8::1", port); got != want {
+			t.Errorf("endpointURL(%+v) = %q, want %q", port, got, want)
+		}
+	}
+
+	if got := serviceEndpoints(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "apps"}}); len(got) != 0 {
+		t.Errorf("serviceEndpoints() of a Service without ports = %v, want none", got)
+	}
+}
@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"time"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// appResources returns the resources every AppWorkload runs on: its ConfigMap,
+// ServiceAccount, Deployment and Service, plus the HorizontalPodAutoscaler when
+// the kind is autoscaled. They are returned in the order they must be created.
+func appResources(cr devopsv1alpha1.AppWorkload, scheme *runtime.Scheme) []client.Object {
+	resources := []client.Object{
+		NewConfigMapCR(cr, configMapData, scheme),
+		NewServiceAccount(cr, scheme),
+		NewDeploymentForCR(cr, scheme),
+		NewService(cr, scheme),
+	}
+	if cr.AppAutoscaling() != nil {
+		resources = append(resources, NewHorizontalPodAutoscalerForCR(cr, scheme))
+	}
+	return resources
+}
+
+// withReconcileTimeout returns ctx bounded by timeout, by the built-in
+// DefaultReconcileTimeout when it is zero. The API calls of a reconcile use
+// the returned context, so they stop on the timeout or when the manager stops.
+func withReconcileTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = configv1alpha1.DefaultReconcileTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ownedClient writes the resources owned by an object of the group and records
+// an event on the owner for every write
+type ownedClient struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// create creates obj labelled as owned by owner and records a Normal event on the owner
+func (c ownedClient) create(ctx context.Context, owner client.Object, obj client.Object) error {
+	setOwnedByLabel(owner, obj)
+	if err := c.Create(ctx, obj); err != nil {
+		return resourceError("create", c.kindOf(obj), obj.GetName(), err)
+	}
+	c.recordEvent(owner, obj, ReasonCreated)
+	return nil
+}
+
+// setOwnedByLabel labels obj as owned by owner
+func setOwnedByLabel(owner client.Object, obj client.Object) {
+	// The builders share the label map with the selectors, copy it
+	labels := map[string]string{devopsv1alpha1.LabelOwnedBy: string(owner.GetUID())}
+	for k, v := range obj.GetLabels() {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+}
+
+// update updates obj and records a Normal event on its owner. An obj the
+// owner does not control is never written.
+func (c ownedClient) update(ctx context.Context, owner client.Object, obj client.Object) error {
+	if err := c.checkControlled(owner, obj); err != nil {
+		return err
+	}
+	if err := c.Update(ctx, obj); err != nil {
+		return resourceError("update", c.kindOf(obj), obj.GetName(), err)
+	}
+	c.recordEvent(owner, obj, ReasonUpdated)
+	return nil
+}
+
+// delete deletes obj and records a Normal event on its owner. An obj the
+// owner does not control is never deleted.
+func (c ownedClient) delete(ctx context.Context, owner client.Object, obj client.Object) error {
+	if err := c.checkControlled(owner, obj); err != nil {
+		return err
+	}
+	if err := c.Delete(ctx, obj); err != nil {
+		return resourceError("delete", c.kindOf(obj), obj.GetName(), client.IgnoreNotFound(err))
+	}
+	c.recordEvent(owner, obj, ReasonDeleted)
+	return nil
+}
+
+// checkControlled returns a NotOwnedError when owner does not control obj
+func (c ownedClient) checkControlled(owner client.Object, obj client.Object) error {
+	if metav1.IsControlledBy(obj, owner) {
+		return nil
+	}
+	notOwned := &NotOwnedError{Kind: c.kindOf(obj), Name: obj.GetName()}
+	if ref := metav1.GetControllerOf(obj); ref != nil {
+		notOwned.Controller = ref.Kind + "/" + ref.Name
+	}
+	return notOwned
+}
+
+// recordEvent records a Normal event such as "Created Deployment learn-sample"
+func (c ownedClient) recordEvent(owner client.Object, obj client.Object, reason string) {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.Eventf(owner, corev1.EventTypeNormal, reason, "%s %s %s", reason, c.kindOf(obj), obj.GetName())
+}
+
+// kindOf returns the kind of obj
+func (c ownedClient) kindOf(obj client.Object) string {
+	if gvk, err := apiutil.GVKForObject(obj, c.scheme); err == nil {
+		return gvk.Kind
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+// recordWarning records a Warning event on the owner for a failed reconcile phase
+func (c ownedClient) recordWarning(owner client.Object, reason string, err error) {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.Event(owner, corev1.EventTypeWarning, reason, err.Error())
+}
+
+// ensureCreated creates obj when it does not exist yet. Only a NotFound error
+// leads to a create, the other errors of the Get are returned classified. An
+// existing obj the owner does not control is adopted as its policy allows.
+func (c ownedClient) ensureCreated(ctx context.Context, owner devopsv1alpha1.AppWorkload, obj client.Object) error {
+	// Decode into an empty object, so the desired owner references do not
+	// survive on a resource that has none
+	existing := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if err == nil {
+		if err := c.adopt(ctx, owner, existing); err != nil {
+			return err
+		}
+		return c.ensureMetadata(ctx, owner, existing, obj)
+	}
+	if !errors.IsNotFound(err) {
+		return resourceError("get", c.kindOf(obj), obj.GetName(), err)
+	}
+	return c.create(ctx, owner, obj)
+}
+
+// ensureMetadata adds the labels and annotations of desired that existing
+// lacks or holds with another value, and those of the pod template of a
+// Deployment. What others set is kept. The selector of a Deployment is
+// immutable and left alone: the pods keep appLabels, which the Deployments
+// created before selectorLabels select on.
+func (c ownedClient) ensureMetadata(ctx context.Context, owner client.Object, existing client.Object, desired client.Object) error {
+	changed := mergeMetadata(existing, desired)
+	if dep, ok := existing.(*appsv1.Deployment); ok {
+		template := &desired.(*appsv1.Deployment).Spec.Template
+		if mergeMetadata(&dep.Spec.Template, template) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return c.update(ctx, owner, existing)
+}
+
+// mergeMetadata sets the labels and annotations of desired on existing and
+// reports whether it changed them
+func mergeMetadata(existing metav1.Object, desired metav1.Object) bool {
+	labels, labelsChanged := mergeStringMap(existing.GetLabels(), desired.GetLabels())
+	annotations, annotationsChanged := mergeStringMap(existing.GetAnnotations(), desired.GetAnnotations())
+	existing.SetLabels(labels)
+	existing.SetAnnotations(annotations)
+	return labelsChanged || annotationsChanged
+}
+
+// mergeStringMap returns have with the entries of want, and whether it had to change
+func mergeStringMap(have, want map[string]string) (map[string]string, bool) {
+	if containsAll(have, want) {
+		return have, false
+	}
+	merged := make(map[string]string, len(have)+len(want))
+	for k, v := range have {
+		merged[k] = v
+	}
+	for k, v := range want {
+		merged[k] = v
+	}
+	return merged, true
+}
+
+// ensureWorkload will ensure that the Deployment of the app runs the image of
+// the spec and that its size is the one of the spec. The HorizontalPodAutoscaler
+// owns the replica count when it exists, its bounds are kept instead.
+func (c ownedClient) ensureWorkload(ctx context.Context, cr devopsv1alpha1.AppWorkload) error {
+	key := client.ObjectKey{Name: cr.AppName(), Namespace: cr.GetNamespace()}
+	dep := &appsv1.Deployment{}
+	if err := c.Get(ctx, key, dep); err != nil {
+		return resourceError("get", "Deployment", key.Name, err)
+	}
+
+	// Ensure the deployment image is the same as the spec
+	if err := c.ensureDepImage(ctx, cr, dep); err != nil {
+		return err
+	}
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := c.Get(ctx, key, hpa)
+	if err == nil {
+		// Ensure the autoscaler bounds are the same as the spec
+		return c.ensureHpaBounds(ctx, cr, hpa)
+	}
+	if !errors.IsNotFound(err) {
+		return resourceError("get", "HorizontalPodAutoscaler", key.Name, err)
+	}
+
+	// Ensure the deployment size is the same as the spec
+	return c.ensureDepSize(ctx, cr, dep)
+}
+
+// ensureDepSize will ensure that the quantity of instances of the deployment is the same defined in the CR
+func (c ownedClient) ensureDepSize(ctx context.Context, cr devopsv1alpha1.AppWorkload, dep *appsv1.Deployment) error {
+	if !setDepSize(cr, dep) {
+		return nil
+	}
+	if err := c.update(ctx, cr, dep); err != nil {
+		return err
+	}
+	driftCorrections.WithLabelValues("Deployment").Inc()
+	return nil
+}
+
+// ensureDepImage will ensure that the app container of the deployment runs the image defined in the CR
+func (c ownedClient) ensureDepImage(ctx context.Context, cr devopsv1alpha1.AppWorkload, dep *appsv1.Deployment) error {
+	if !setAppImage(cr, dep) {
+		return nil
+	}
+	if err := c.update(ctx, cr, dep); err != nil {
+		return err
+	}
+	driftCorrections.WithLabelValues("Deployment").Inc()
+	return nil
+}
+
+// setDepSize sets the replicas of the CR on dep and reports whether it changed them
+func setDepSize(cr devopsv1alpha1.AppWorkload, dep *appsv1.Deployment) bool {
+	size := cr.AppReplicas()
+	if dep.Spec.Replicas != nil && *dep.Spec.Replicas == size {
+		return false
+	}
+	dep.Spec.Replicas = &size
+	return true
+}
+
+// setAppImage sets the image of the CR on the app container of dep and reports whether it changed it
+func setAppImage(cr devopsv1alpha1.AppWorkload, dep *appsv1.Deployment) bool {
+	for i := range dep.Spec.Template.Spec.Containers {
+		container := &dep.Spec.Template.Spec.Containers[i]
+		if container.Name == cr.AppName() && container.Image != cr.AppImage() {
+			container.Image = cr.AppImage()
+			return true
+		}
+	}
+	return false
+}
+
+// ensureHpaBounds will ensure that the HorizontalPodAutoscaler scales between the bounds defined in the CR
+func (c ownedClient) ensureHpaBounds(ctx context.Context, cr devopsv1alpha1.AppWorkload, hpa *autoscalingv2beta2.HorizontalPodAutoscaler) error {
+	if !setHpaBounds(cr, hpa) {
+		return nil
+	}
+	if err := c.update(ctx, cr, hpa); err != nil {
+		return err
+	}
+	driftCorrections.WithLabelValues("HorizontalPodAutoscaler").Inc()
+	return nil
+}
+
+// setHpaBounds sets the autoscaler bounds of the CR on hpa and reports whether it changed them
+func setHpaBounds(cr devopsv1alpha1.AppWorkload, hpa *autoscalingv2beta2.HorizontalPodAutoscaler) bool {
+	autoscaling := cr.AppAutoscaling()
+	if autoscaling == nil || autoscaling.MinReplicas == 0 || autoscaling.MaxReplicas == 0 {
+		return false
+	}
+	minReplicas := autoscaling.MinReplicas
+	maxReplicas := autoscaling.MaxReplicas
+	if hpa.Spec.MinReplicas != nil && *hpa.Spec.MinReplicas == minReplicas && hpa.Spec.MaxReplicas == maxReplicas {
+		return false
+	}
+	hpa.Spec.MinReplicas = &minReplicas
+	hpa.Spec.MaxReplicas = maxReplicas
+	return true
+}
+
+// ensureService will ensure that the Service of the app is exposed as the spec
+// asks: its type, ports, traffic policy and session affinity. The addresses and
+// ports the API server allocated are kept. The cluster IP of a Service cannot
+// change, so a Service switching to or from Headless is recreated.
+func (c ownedClient) ensureService(ctx context.Context, cr devopsv1alpha1.AppWorkload) error {
+	desired := NewService(cr, c.scheme)
+	svc := &corev1.Service{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(desired), svc); err != nil {
+		return resourceError("get", "Service", desired.Name, err)
+	}
+	if isHeadless(svc) != isHeadless(desired) {
+		// The old Service may outlive its deletion for a while, the finalizer
+		// of a load balancer controller for instance. The reconcile is retried
+		// until it is gone and the create step makes the new one.
+		if svc.GetDeletionTimestamp() == nil {
+			if err := c.delete(ctx, cr, svc); err != nil {
+				return err
+			}
+		}
+		return &ResourceError{Verb: "recreate", Kind: "Service", Name: svc.Name, Class: ErrorConflict, Err: goerrors.New("waiting for the old Service to be deleted")}
+	}
+
+	keepAllocatedServiceFields(desired, svc)
+	want := svc.DeepCopy()
+	setServiceSpec(want, desired)
+	if equality.Semantic.DeepEqual(want.Spec, svc.Spec) {
+		return nil
+	}
+	if err := c.update(ctx, cr, want); err != nil {
+		return err
+	}
+	driftCorrections.WithLabelValues("Service").Inc()
+	return nil
+}
+
+// setServiceSpec copies to svc the fields of the spec of desired the operator
+// owns, the others are left to the API server and to other controllers
+func setServiceSpec(svc *corev1.Service, desired *corev1.Service) {
+	svc.Spec.Selector = desired.Spec.Selector
+	svc.Spec.Type = desired.Spec.Type
+	svc.Spec.Ports = desired.Spec.Ports
+	svc.Spec.LoadBalancerSourceRanges = desired.Spec.LoadBalancerSourceRanges
+	svc.Spec.ExternalTrafficPolicy = desired.Spec.ExternalTrafficPolicy
+	svc.Spec.HealthCheckNodePort = desired.Spec.HealthCheckNodePort
+	svc.Spec.SessionAffinity = desired.Spec.SessionAffinity
+	svc.Spec.SessionAffinityConfig = desired.Spec.SessionAffinityConfig
+}
+
+// keepAllocatedServiceFields copies to desired what the API server allocated
+// to live: its cluster IPs, unless one of them is headless, the node ports the
+// spec leaves empty and the health check node port of a Local load balancer
+func keepAllocatedServiceFields(desired *corev1.Service, live *corev1.Service) {
+	if isHeadless(desired) == isHeadless(live) {
+		desired.Spec.ClusterIP = live.Spec.ClusterIP
+		desired.Spec.ClusterIPs = live.Spec.ClusterIPs
+	}
+	if desired.Spec.Type != corev1.ServiceTypeNodePort && desired.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return
+	}
+	allocated := make(map[string]int32, len(live.Spec.Ports))
+	for _, port := range live.Spec.Ports {
+		allocated[port.Name] = port.NodePort
+	}
+	for i := range desired.Spec.Ports {
+		if desired.Spec.Ports[i].NodePort == 0 {
+			desired.Spec.Ports[i].NodePort = allocated[desired.Spec.Ports[i].Name]
+		}
+	}
+	if desired.Spec.Type == corev1.ServiceTypeLoadBalancer && desired.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyTypeLocal {
+		desired.Spec.HealthCheckNodePort = live.Spec.HealthCheckNodePort
+	}
+}
+
+// isHeadless reports whether svc has no cluster IP
+func isHeadless(svc *corev1.Service) bool {
+	return svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// deploymentSelector returns the label selector of the Deployment in its string form
+func deploymentSelector(dep *appsv1.Deployment) string {
+	selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector)
+	if err != nil {
+		return ""
+	}
+	return selector.String()
+}
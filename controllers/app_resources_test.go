@@ -0,0 +1,559 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+func TestStatusReconcileCreatesResources(t *testing.T) {
+	status := &devopsv1alpha1.Status{
+		ObjectMeta: metav1.ObjectMeta{Name: "status-sample", Namespace: "default", UID: "status-uid"},
+		Spec:       devopsv1alpha1.StatusSpec{Image: "dxas90/learn:v1", Replicas: 2},
+	}
+	base := newFakeReconciler(status)
+	r := &StatusReconciler{Client: base.Client, Scheme: base.Scheme, Recorder: base.Recorder}
+
+	key := types.NamespacedName{Name: status.Name, Namespace: status.Namespace}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{},
+		&corev1.Service{},
+		&autoscalingv2beta2.HorizontalPodAutoscaler{},
+		&corev1.ServiceAccount{},
+		&corev1.ConfigMap{},
+	} {
+		name := key
+		switch obj.(type) {
+		case *corev1.ServiceAccount:
+			name.Name += "-sa"
+		case *corev1.ConfigMap:
+			name.Name += "-conf"
+		}
+		if err := r.Get(context.Background(), name, obj); err != nil {
+			t.Fatalf("get %T: %v", obj, err)
+		}
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil || owner.Kind != "Status" || owner.UID != status.UID {
+			t.Errorf("%T controller = %v, want the Status", obj, owner)
+		}
+	}
+
+	got := &devopsv1alpha1.Status{}
+	if err := r.Get(context.Background(), key, got); err != nil {
+		t.Fatalf("get status: %v", err)
+	}
+	if got.Status.CurrentStatus != "OK" {
+		t.Errorf("currentStatus = %q, want OK", got.Status.CurrentStatus)
+	}
+	if got.Status.LabelSelector == "" || got.Status.HorizontalPodAutoscalerStatus == nil {
+		t.Errorf("status not filled in: %+v", got.Status)
+	}
+}
+
+func TestStatusReconcileWithoutAutoscaling(t *testing.T) {
+	disabled := false
+	status := &devopsv1alpha1.Status{
+		ObjectMeta: metav1.ObjectMeta{Name: "status-sample", Namespace: "default", UID: "status-uid"},
+		Spec: devopsv1alpha1.StatusSpec{
+			Image:       "dxas90/learn:v1",
+			Replicas:    2,
+			Autoscaling: &devopsv1alpha1.AutoscalingSpec{Enabled: &disabled},
+		},
+	}
+	base := newFakeReconciler(status)
+	r := &StatusReconciler{Client: base.Client, Scheme: base.Scheme, Recorder: base.Recorder}
+
+	key := types.NamespacedName{Name: status.Name, Namespace: status.Namespace}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if err := r.Get(context.Background(), key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); !errors.IsNotFound(err) {
+		t.Errorf("HorizontalPodAutoscaler created with autoscaling disabled, error = %v", err)
+	}
+	got := &devopsv1alpha1.Status{}
+	if err := r.Get(context.Background(), key, got); err != nil {
+		t.Fatalf("get status: %v", err)
+	}
+	if got.Status.CurrentStatus != "OK" || got.Status.HorizontalPodAutoscalerStatus != nil {
+		t.Errorf("currentStatus = %q, hpaStatus = %+v, want OK without a HorizontalPodAutoscaler status",
+			got.Status.CurrentStatus, got.Status.HorizontalPodAutoscalerStatus)
+	}
+}
+
+func TestCryptoReconcileCorrectsDrift(t *testing.T) {
+	crypto := &devopsv1alpha1.Crypto{
+		ObjectMeta: metav1.ObjectMeta{Name: "crypto-sample", Namespace: "default", UID: "crypto-uid"},
+		Spec:       devopsv1alpha1.CryptoSpec{Image: "dxas90/learn:v1", Replicas: 3},
+	}
+	base := newFakeReconciler(crypto)
+	r := &CryptoReconciler{Client: base.Client, Scheme: base.Scheme, Recorder: base.Recorder}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Name: crypto.Name, Namespace: crypto.Namespace}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	one := int32(1)
+	dep.Spec.Replicas = &one
+	dep.Spec.Template.Spec.Containers[0].Image = "dxas90/learn:old"
+	if err := r.Update(ctx, dep); err != nil {
+		t.Fatalf("update deployment: %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("second reconcile: %v", err)
+	}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *dep.Spec.Replicas != 3 || dep.Spec.Template.Spec.Containers[0].Image != "dxas90/learn:v1" {
+		t.Errorf("drift not corrected: replicas=%d image=%s", *dep.Spec.Replicas, dep.Spec.Template.Spec.Containers[0].Image)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: key.Name, Namespace: key.Namespace}, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err == nil {
+		t.Errorf("a Crypto must not get a HorizontalPodAutoscaler")
+	}
+}
+
+func TestAppResourcesShareLabelsAndOwner(t *testing.T) {
+	s := newFakeReconciler().Scheme
+	meta := metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "app-uid"}
+	for _, tc := range []struct {
+		workload devopsv1alpha1.AppWorkload
+		kind     string
+		count    int
+	}{
+		{&devopsv1alpha1.Learn{ObjectMeta: meta}, "Learn", 5},
+		{&devopsv1alpha1.Status{ObjectMeta: meta}, "Status", 5},
+		{&devopsv1alpha1.Crypto{ObjectMeta: meta}, "Crypto", 4},
+	} {
+		resources := appResources(tc.workload, s)
+		if len(resources) != tc.count {
+			t.Errorf("%s: got %d resources, want %d", tc.kind, len(resources), tc.count)
+		}
+		for _, obj := range resources {
+			if got := obj.GetLabels(); got["app"] != "app" || got["devops"] != "app" {
+				t.Errorf("%s: %T labels = %v", tc.kind, obj, got)
+			}
+			owner := metav1.GetControllerOf(obj)
+			if owner == nil || owner.Kind != tc.kind || owner.UID != "app-uid" {
+				t.Errorf("%s: %T controller = %v", tc.kind, obj, owner)
+			}
+		}
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	for image, want := range map[string]string{
+		"dxas90/learn:1.0.0":                     "1.0.0",
+		"dxas90/learn":                           "",
+		"registry:5000/dxas90/learn":             "",
+		"registry:5000/dxas90/learn:v2":          "v2",
+		"dxas90/learn:1.0.0@sha256:0123456789ab": "1.0.0",
+		"dxas90/learn@sha256:0123456789ab":       "",
+	} {
+		if got := imageVersion(image); got != want {
+			t.Errorf("imageVersion(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestLegacySelectorIsKept(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image:        "dxas90/learn:1.0.0",
+			Replicas:     2,
+			CommonLabels: map[string]string{"team": "payments"},
+		},
+	}
+	r := newFakeReconciler(learn)
+	// A Deployment created before the recommended labels selects on the app labels
+	legacy := NewDeploymentForCR(learn, r.Scheme)
+	legacy.Labels = appLabels(learn)
+	setOwnedByLabel(learn, legacy)
+	legacy.Spec.Selector = &metav1.LabelSelector{MatchLabels: appLabels(learn)}
+	legacy.Spec.Template.Labels = appLabels(learn)
+	ctx := context.Background()
+	if err := r.Create(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(dep.Spec.Selector.MatchLabels, appLabels(learn)) {
+		t.Errorf("Deployment selector = %v, want the legacy one kept", dep.Spec.Selector.MatchLabels)
+	}
+	for _, labels := range []map[string]string{dep.Labels, dep.Spec.Template.Labels} {
+		if labels["team"] != "payments" || labels["app.kubernetes.io/instance"] != learn.Name || labels["app"] != learn.Name {
+			t.Errorf("labels = %v, want the common, recommended and app labels", labels)
+		}
+	}
+	checkOwnedResources(t, r, learn)
+}
+
+func TestReconcileExposesService(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	reconcile := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	// allocate stands for the API server, which the fake client does not run
+	allocate := func(mutate func(svc *corev1.Service)) {
+		t.Helper()
+		svc := &corev1.Service{}
+		if err := r.Get(ctx, key, svc); err != nil {
+			t.Fatal(err)
+		}
+		mutate(svc)
+		if err := r.Update(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setSpec := func(service *devopsv1alpha1.ServiceSpec) {
+		t.Helper()
+		live := &devopsv1alpha1.Learn{}
+		if err := r.Get(ctx, key, live); err != nil {
+			t.Fatal(err)
+		}
+		live.Spec.Service = service
+		if err := r.Update(ctx, live); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile()
+	allocate(func(svc *corev1.Service) { svc.Spec.ClusterIP = "10.96.0.10" })
+
+	setSpec(&devopsv1alpha1.ServiceSpec{
+		Type:                  devopsv1alpha1.ServiceLoadBalancer,
+		Ports:                 []devopsv1alpha1.ServicePort{{Name: "http", Port: 80, TargetPort: &intstr.IntOrString{Type: intstr.String, StrVal: "web"}}},
+		ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal,
+	})
+	reconcile()
+	allocate(func(svc *corev1.Service) {
+		svc.Spec.Ports[0].NodePort = 31000
+		svc.Spec.HealthCheckNodePort = 32000
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+	})
+	// The allocated ports are kept, the Service is not written again
+	counting := &writeCountingClient{Client: r.Client}
+	r.Client = counting
+	reconcile()
+	for _, write := range counting.writes {
+		if write == "update *v1.Service learn-sample" {
+			t.Errorf("Reconcile() wrote %v, want the allocated ports kept", counting.writes)
+		}
+	}
+
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer || svc.Spec.ClusterIP != "10.96.0.10" || svc.Spec.Ports[0].NodePort != 31000 || svc.Spec.HealthCheckNodePort != 32000 {
+		t.Errorf("Service spec = %+v, want a LoadBalancer keeping its cluster IP and node ports", svc.Spec)
+	}
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	want := []devopsv1alpha1.Endpoint{
+		{Port: "http", URL: "http://learn-sample.default.svc"},
+		{Port: "http", URL: "http://203.0.113.10", External: true},
+	}
+	if !equality.Semantic.DeepEqual(live.Status.Endpoints, want) {
+		t.Errorf("status.endpoints = %+v, want %+v", live.Status.Endpoints, want)
+	}
+
+	// The cluster IP cannot change, a Headless Service is recreated once the
+	// old one is gone
+	setSpec(&devopsv1alpha1.ServiceSpec{Type: devopsv1alpha1.ServiceHeadless})
+	if result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil || !result.Requeue {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue while the old Service is deleted", result, err)
+	}
+	if err := r.Get(ctx, key, &corev1.Service{}); !errors.IsNotFound(err) {
+		t.Fatalf("Service get error = %v, want the old Service deleted", err)
+	}
+	reconcile()
+	svc = &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Spec.ClusterIP != corev1.ClusterIPNone || svc.Spec.Type != corev1.ServiceTypeClusterIP || svc.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("Service spec = %+v, want a Headless Service without node ports", svc.Spec)
+	}
+	checkOwnedResources(t, r, learn)
+}
+
+// finalizingClient keeps the objects that have finalizers on delete and marks
+// them as being deleted, as the API server does
+type finalizingClient struct {
+	client.Client
+	deletes int
+}
+
+func (c *finalizingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.deletes++
+	if len(obj.GetFinalizers()) == 0 {
+		return c.Client.Delete(ctx, obj, opts...)
+	}
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	return c.Client.Update(ctx, obj)
+}
+
+func TestReconcileWaitsForServiceFinalizer(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image:    "dxas90/learn:1.0.0",
+			Replicas: 2,
+			Service:  &devopsv1alpha1.ServiceSpec{Type: devopsv1alpha1.ServiceLoadBalancer},
+		},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The load balancer controller holds the Service until its load balancer is released
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	svc.Finalizers = []string{"service.kubernetes.io/load-balancer-cleanup"}
+	if err := r.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	live.Spec.Service = &devopsv1alpha1.ServiceSpec{Type: devopsv1alpha1.ServiceHeadless}
+	if err := r.Update(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+
+	finalizing := &finalizingClient{Client: r.Client}
+	r.Client = finalizing
+	for i := 0; i < 3; i++ {
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil || !result.Requeue {
+			t.Fatalf("Reconcile() = %+v, %v, want a requeue while the old Service is deleted", result, err)
+		}
+	}
+	if finalizing.deletes != 1 {
+		t.Errorf("Service deleted %d times, want once", finalizing.deletes)
+	}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	ready := meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionReady)
+	if ready == nil || ready.Reason != string(ErrorConflict) || strings.Contains(ready.Message, "already exists") {
+		t.Errorf("Ready condition = %+v, want a Conflict waiting for the old Service", ready)
+	}
+
+	// The load balancer is released, the Service goes away and is recreated Headless
+	if err := finalizing.Client.Delete(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	svc = &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if !isHeadless(svc) || svc.GetDeletionTimestamp() != nil {
+		t.Errorf("Service spec = %+v, want a new Headless Service", svc.Spec)
+	}
+}
+
+// driftLearn returns a Learn without autoscaling, so its replicas are enforced on the Deployment
+func driftLearn() *devopsv1alpha1.Learn {
+	disabled := false
+	return &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image:       "dxas90/learn:1.0.0",
+			Replicas:    3,
+			Autoscaling: &devopsv1alpha1.AutoscalingSpec{Enabled: &disabled},
+		},
+	}
+}
+
+func TestEnsureDepSize(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		replicas  *int32
+		wantWrite bool
+	}{
+		// A pointer to an equal value is no drift, comparing the pointers would update every reconcile
+		{"equal value", func() *int32 { n := int32(3); return &n }(), false},
+		{"different value", func() *int32 { n := int32(1); return &n }(), true},
+		{"unset", nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			learn := driftLearn()
+			base := newFakeReconciler(learn)
+			dep := NewDeploymentForCR(learn, base.Scheme)
+			dep.Spec.Replicas = tt.replicas
+			if err := base.Create(context.Background(), dep); err != nil {
+				t.Fatal(err)
+			}
+			counting := &writeCountingClient{Client: base.Client}
+			base.Client = counting
+
+			if err := base.owned().ensureDepSize(context.Background(), learn, dep); err != nil {
+				t.Fatalf("ensureDepSize() error = %v", err)
+			}
+			if wrote := len(counting.writes) > 0; wrote != tt.wantWrite {
+				t.Errorf("ensureDepSize() writes = %v, want a write %v", counting.writes, tt.wantWrite)
+			}
+			live := &appsv1.Deployment{}
+			if err := base.Get(context.Background(), client.ObjectKeyFromObject(dep), live); err != nil {
+				t.Fatal(err)
+			}
+			if live.Spec.Replicas == nil || *live.Spec.Replicas != 3 {
+				t.Errorf("Deployment replicas = %v, want 3", live.Spec.Replicas)
+			}
+		})
+	}
+}
+
+func TestEnsureDepImage(t *testing.T) {
+	learn := driftLearn()
+	base := newFakeReconciler(learn)
+	ctx := context.Background()
+	dep := NewDeploymentForCR(learn, base.Scheme)
+	dep.Spec.Template.Spec.Containers[0].Image = "dxas90/learn:0.9.0"
+	dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers, corev1.Container{Name: "sidecar", Image: "envoyproxy/envoy:v1.18"})
+	if err := base.Create(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+	counting := &writeCountingClient{Client: base.Client}
+	base.Client = counting
+
+	if err := base.owned().ensureDepImage(ctx, learn, dep); err != nil {
+		t.Fatalf("ensureDepImage() error = %v", err)
+	}
+	live := &appsv1.Deployment{}
+	if err := base.Get(ctx, client.ObjectKeyFromObject(dep), live); err != nil {
+		t.Fatal(err)
+	}
+	if images := []string{live.Spec.Template.Spec.Containers[0].Image, live.Spec.Template.Spec.Containers[1].Image}; images[0] != "dxas90/learn:1.0.0" || images[1] != "envoyproxy/envoy:v1.18" {
+		t.Errorf("container images = %v, want the app image corrected and the sidecar left alone", images)
+	}
+
+	// Once corrected the Deployment is not written again
+	counting.writes = nil
+	if err := base.owned().ensureDepImage(ctx, learn, live); err != nil {
+		t.Fatalf("ensureDepImage() error = %v", err)
+	}
+	if len(counting.writes) != 0 {
+		t.Errorf("ensureDepImage() writes = %v, want none without drift", counting.writes)
+	}
+}
+
+func TestEnsureWorkloadLeavesReplicasToAutoscaler(t *testing.T) {
+	learn := driftLearn()
+	learn.Spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{MinReplicas: 2, MaxReplicas: 6}
+	base := newFakeReconciler(learn)
+	ctx := context.Background()
+	dep := NewDeploymentForCR(learn, base.Scheme)
+	scaled := int32(5)
+	dep.Spec.Replicas = &scaled
+	hpa := NewHorizontalPodAutoscalerForCR(learn, base.Scheme)
+	hpa.Spec.MaxReplicas = 10
+	for _, obj := range []client.Object{dep, hpa} {
+		if err := base.Create(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := base.owned().ensureWorkload(ctx, learn); err != nil {
+		t.Fatalf("ensureWorkload() error = %v", err)
+	}
+	if err := base.Get(ctx, client.ObjectKeyFromObject(dep), dep); err != nil {
+		t.Fatal(err)
+	}
+	if *dep.Spec.Replicas != 5 {
+		t.Errorf("Deployment replicas = %d, want the 5 of the autoscaler kept", *dep.Spec.Replicas)
+	}
+	if err := base.Get(ctx, client.ObjectKeyFromObject(hpa), hpa); err != nil {
+		t.Fatal(err)
+	}
+	if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 6 {
+		t.Errorf("HorizontalPodAutoscaler bounds = %d-%d, want 2-6", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+}
+
+func TestReconcileCorrectsDeploymentDrift(t *testing.T) {
+	learn := driftLearn()
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	one := int32(1)
+	dep.Spec.Replicas = &one
+	dep.Spec.Template.Spec.Containers[0].Image = "dxas90/learn:0.9.0"
+	if err := r.Update(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if *dep.Spec.Replicas != 3 || dep.Spec.Template.Spec.Containers[0].Image != "dxas90/learn:1.0.0" {
+		t.Errorf("drift not corrected: replicas=%d image=%s", *dep.Spec.Replicas, dep.Spec.Template.Spec.Containers[0].Image)
+	}
+}
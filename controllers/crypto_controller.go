@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// CryptoReconciler reconciles a Crypto object. A Crypto runs the same app as a
+// Learn with a fixed number of replicas and no autoscaler.
+type CryptoReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Defaults are applied to the fields a Crypto leaves empty
+	Defaults configv1alpha1.LearnDefaults
+	// MaxConcurrentReconciles is the number of Crypto objects reconciled in parallel
+	MaxConcurrentReconciles int
+	// ReconcileTimeout bounds a reconcile, DefaultReconcileTimeout is used when zero
+	ReconcileTimeout time.Duration
+}
+
+//+kubebuilder:rbac:groups=devops.dxas90,resources=cryptoes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=devops.dxas90,resources=cryptoes/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=devops.dxas90,resources=cryptoes/finalizers,verbs=update
+
+// Reconcile creates the ConfigMap, ServiceAccount, Deployment and Service of a
+// Crypto, keeps the Deployment image and replicas in line with the spec and
+// reports the replicas and pod selector of the Deployment.
+func (r *CryptoReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := withReconcileTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+	reqLogger := log.FromContext(ctx)
+
+	instance := &devopsv1alpha1.Crypto{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			// The owned resources are garbage collected through their owner references
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if instance.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	setCryptoDefaults(instance, r.Defaults)
+	owned := ownedClient{Client: r.Client, scheme: r.Scheme, recorder: r.Recorder}
+	for _, obj := range appResources(instance, r.Scheme) {
+		if err := owned.ensureCreated(ctx, instance, obj); err != nil {
+			reqLogger.Error(err, "Failed to create Crypto resource", "name", obj.GetName())
+			return ctrl.Result{}, err
+		}
+	}
+	if err := owned.ensureWorkload(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	status := devopsv1alpha1.CryptoStatus{
+		Replicas:      deployment.Status.Replicas,
+		LabelSelector: deploymentSelector(deployment),
+	}
+	if status == instance.Status {
+		return ctrl.Result{}, nil
+	}
+	instance.Status = status
+	return ctrl.Result{}, r.Status().Update(ctx, instance)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CryptoReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		For(&devopsv1alpha1.Crypto{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.ServiceAccount{}).
+		Complete(r)
+}
+
+// setCryptoDefaults fills the spec fields the user left empty with the operator defaults
+func setCryptoDefaults(cr *devopsv1alpha1.Crypto, defaults configv1alpha1.LearnDefaults) {
+	defaults.Default()
+	if cr.Spec.Replicas <= 0 {
+		cr.Spec.Replicas = defaults.Replicas
+	}
+	if cr.Spec.Image == "" {
+		cr.Spec.Image = defaults.Image
+	}
+}
@@ -2,97 +2,125 @@ package controllers
 
 import (
 	"context"
+	goerrors "errors"
+	"fmt"
+	"reflect"
 
-	appsv1 "k8s.io/api/apps/v1"
-	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
-	"k8s.io/api/batch/v1beta1"
-	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
 )
 
-//FetchHorizontalPodAutoscaler returns the HorizontalPodAutoscaler resource with the name in the namespace
-func FetchHorizontalPodAutoscaler(name, namespace string, client client.Client) (*autoscalingv2beta2.HorizontalPodAutoscaler, error) {
-	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, hpa)
-	return hpa, err
+// NotFoundError is returned by Fetch when the resource does not exist. It
+// wraps the error of the API, so errors.IsNotFound holds for it too.
+type NotFoundError struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Err       error
 }
 
-//FetchServiceAccount returns the ServiceAccount resource with the name in the namespace
-func FetchServiceAccount(name, namespace string, client client.Client) (*corev1.ServiceAccount, error) {
-	serviceaccount := &corev1.ServiceAccount{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, serviceaccount)
-	return serviceaccount, err
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s/%s not found", e.Kind, e.Namespace, e.Name)
 }
 
-//FetchRoleBinding returns the RoleBinding resource with the name in the namespace
-func FetchRoleBinding(name, namespace string, client client.Client) (*rbacv1.RoleBinding, error) {
-	rolebinding := &rbacv1.RoleBinding{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, rolebinding)
-	return rolebinding, err
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
 }
 
-//FetchNetworkPolicy returns the NetworkPolicy resource with the name in the namespace
-func FetchNetworkPolicy(name, namespace string, client client.Client) (*networkingv1.NetworkPolicy, error) {
-	networkpolicy := &networkingv1.NetworkPolicy{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, networkpolicy)
-	return networkpolicy, err
+// IsNotFound tells whether err is the NotFoundError of a Fetch
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return goerrors.As(err, &notFound)
 }
 
-//FetchService returns the Service resource with the name in the namespace
-func FetchService(name, namespace string, client client.Client) (*corev1.Service, error) {
-	service := &corev1.Service{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, service)
-	return service, err
+// Fetch returns the resource of type T with the name in the namespace, read
+// through reader. A missing resource is reported as a *NotFoundError, any
+// other error as it comes from reader.
+//
+//	dep, err := Fetch[*appsv1.Deployment](ctx, "learn", "default", r.Client)
+func Fetch[T client.Object](ctx context.Context, name, namespace string, reader client.Reader) (T, error) {
+	obj := newObject[T]()
+	err := reader.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, obj)
+	if errors.IsNotFound(err) {
+		err = &NotFoundError{Kind: reflect.TypeOf(obj).Elem().Name(), Name: name, Namespace: namespace, Err: err}
+	}
+	return obj, err
 }
 
-//FetchService returns the Deployment resource with the name in the namespace
-func FetchDeployment(name, namespace string, client client.Client) (*appsv1.Deployment, error) {
-	deployment := &appsv1.Deployment{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, deployment)
-	return deployment, err
-}
+// OwnerMatch is how ListOwned recognises the children of an owner
+type OwnerMatch int
 
-//FetchPersistentVolumeClaim returns the PersistentVolumeClaim resource with the name in the namespace
-func FetchPersistentVolumeClaim(name, namespace string, client client.Client) (*corev1.PersistentVolumeClaim, error) {
-	pvc := &corev1.PersistentVolumeClaim{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, pvc)
-	return pvc, err
-}
+const (
+	// MatchOwnerUID picks the resources with an owner reference to the UID of
+	// the owner
+	MatchOwnerUID OwnerMatch = iota
+	// MatchAppLabels picks the resources carrying the app and devops labels
+	// of the owner, whoever owns them
+	MatchAppLabels
+)
 
-//FetchCronJob returns the CronJob resource with the name in the namespace
-func FetchCronJob(name, namespace string, client client.Client) (*v1beta1.CronJob, error) {
-	cronJob := &v1beta1.CronJob{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, cronJob)
-	return cronJob, err
-}
+// ListOwned returns the resources of type T in the namespace of owner that
+// belong to it, as told by match. The manager client reads from its cache,
+// its APIReader reads from the API server: pass the latter as reader when
+// the cache may lag behind a write just made or does not watch the kind.
+func ListOwned[T client.Object](ctx context.Context, reader client.Reader, scheme *runtime.Scheme, owner devopsv1alpha1.AppWorkload, match OwnerMatch) ([]T, error) {
+	gvk, err := apiutil.GVKForObject(newObject[T](), scheme)
+	if err != nil {
+		return nil, err
+	}
+	listObj, err := scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return nil, err
+	}
+	list, ok := listObj.(client.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a list", gvk.Kind+"List")
+	}
 
-//FetchSecret returns the Secret resource with the name in the namespace
-func FetchSecret(name, namespace string, client client.Client) (*corev1.Secret, error) {
-	secret := &corev1.Secret{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, secret)
-	return secret, err
-}
+	opts := []client.ListOption{client.InNamespace(owner.GetNamespace())}
+	if match == MatchAppLabels {
+		opts = append(opts, client.MatchingLabels(appLabels(owner)))
+	}
+	if err := reader.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
 
-//FetchSecret returns the ConfigMap resource with the name in the namespace
-func FetchConfigMap(name, namespace string, client client.Client) (*corev1.ConfigMap, error) {
-	cfg := &corev1.ConfigMap{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, cfg)
-	return cfg, err
+	owned := make([]T, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(T)
+		if !ok {
+			return nil, fmt.Errorf("%s holds a %T, want a %s", gvk.Kind+"List", item, gvk.Kind)
+		}
+		if match == MatchOwnerUID && !ownedBy(obj, owner.GetUID()) {
+			continue
+		}
+		owned = append(owned, obj)
+	}
+	return owned, nil
 }
 
-//FetchSecret returns the ConfigMap resource with the name in the namespace
-func FetchStatefulSet(name, namespace string, client client.Client) (*appsv1.StatefulSet, error) {
-	cfg := &appsv1.StatefulSet{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, cfg)
-	return cfg, err
+// ownedBy tells whether obj has an owner reference to uid
+func ownedBy(obj client.Object, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
 }
 
-//FetchSecret returns the ConfigMap resource with the name in the namespace
-func FetchEndpoints(name, namespace string, client client.Client) (*corev1.Endpoints, error) {
-	cfg := &corev1.Endpoints{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, cfg)
-	return cfg, err
+// newObject returns a new empty object of the pointer type T
+func newObject[T client.Object]() T {
+	var zero T
+	return reflect.New(reflect.TypeOf(zero).Elem()).Interface().(T)
 }
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+func TestFetchDistinguishesNotFound(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default"}}
+	r := newFakeReconciler(svc)
+	ctx := context.Background()
+
+	got, err := Fetch[*corev1.Service](ctx, "learn-sample", "default", r.Client)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got.Name != "learn-sample" {
+		t.Errorf("Fetch() = %s, want learn-sample", got.Name)
+	}
+
+	_, err = Fetch[*corev1.ConfigMap](ctx, "learn-sample", "default", r.Client)
+	if !IsNotFound(err) || !errors.IsNotFound(err) {
+		t.Fatalf("Fetch() of a missing ConfigMap error = %v, want a NotFoundError", err)
+	}
+	if want := "ConfigMap default/learn-sample not found"; err.Error() != want {
+		t.Errorf("Fetch() error = %q, want %q", err, want)
+	}
+	if IsNotFound(fmt.Errorf("connection refused")) {
+		t.Error("IsNotFound() holds for an error that is not a NotFoundError")
+	}
+}
+
+func TestListOwnedMatches(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"}}
+	ownerRef := []metav1.OwnerReference{{APIVersion: "devops.dxas90/v1alpha1", Kind: "Learn", Name: learn.Name, UID: learn.UID}}
+	labels := map[string]string{"app": learn.Name, "devops": learn.Name}
+	r := newFakeReconciler(learn,
+		// Owned and labelled
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "both", Namespace: "default", OwnerReferences: ownerRef, Labels: labels}},
+		// Owned only
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "default", OwnerReferences: ownerRef}},
+		// Labelled only
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "labelled", Namespace: "default", Labels: labels}},
+		// Neither, or in another namespace
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "elsewhere", Namespace: "other", OwnerReferences: ownerRef, Labels: labels}},
+	)
+
+	for _, tt := range []struct {
+		match OwnerMatch
+		want  []string
+	}{
+		{MatchOwnerUID, []string{"both", "owned"}},
+		{MatchAppLabels, []string{"both", "labelled"}},
+	} {
+		owned, err := ListOwned[*corev1.ConfigMap](context.Background(), r.Client, r.Scheme, learn, tt.match)
+		if err != nil {
+			t.Fatalf("ListOwned(%d) error = %v", tt.match, err)
+		}
+		var got []string
+		for _, cm := range owned {
+			got = append(got, cm.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ListOwned(%d) = %v, want %v", tt.match, got, tt.want)
+		}
+	}
+}
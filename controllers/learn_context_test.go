@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// contextClient fails the calls made with a done context, as the client of
+// the manager does, and blocks its creates until the context is done when
+// blockCreates is set
+type contextClient struct {
+	*writeCountingClient
+	blockCreates bool
+}
+
+func (c *contextClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.Get(ctx, key, obj)
+}
+
+func (c *contextClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.List(ctx, list, opts...)
+}
+
+func (c *contextClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if c.blockCreates {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.Create(ctx, obj, opts...)
+}
+
+func (c *contextClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.Update(ctx, obj, opts...)
+}
+
+func (c *contextClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *contextClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.writeCountingClient.Delete(ctx, obj, opts...)
+}
+
+// newContextReconciler returns a reconciler of a new Learn on a contextClient
+func newContextReconciler(blockCreates bool) (*LearnReconciler, *contextClient, ctrl.Request) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+	r := newFakeReconciler(learn)
+	c := &contextClient{writeCountingClient: &writeCountingClient{Client: r.Client}, blockCreates: blockCreates}
+	r.Client = c
+	return r, c, ctrl.Request{NamespacedName: types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}}
+}
+
+func TestReconcileHonorsCancellation(t *testing.T) {
+	r, c, req := newContextReconciler(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	// The manager cancels the context of the reconciles when it stops
+	cancel()
+
+	if _, err := r.Reconcile(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Reconcile() error = %v, want %v", err, context.Canceled)
+	}
+	if len(c.writes) > 0 {
+		t.Errorf("cancelled Reconcile() wrote %v, want no write", c.writes)
+	}
+}
+
+func TestReconcileTimesOut(t *testing.T) {
+	r, _, req := newContextReconciler(true)
+	r.ReconcileTimeout = 50 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Reconcile(context.Background(), req)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Reconcile() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reconcile() still blocked on a create after its timeout")
+	}
+}
+
+func TestWithReconcileTimeoutDefault(t *testing.T) {
+	ctx, cancel := withReconcileTimeout(context.Background(), 0)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("context has no deadline")
+	}
+	if left := time.Until(deadline); left <= time.Minute || left > 2*time.Minute {
+		t.Errorf("deadline in %v, want the default of 2m", left)
+	}
+}
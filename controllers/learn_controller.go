@@ -18,20 +18,28 @@ package controllers
 
 import (
 	"context"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
 	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
 )
 
@@ -40,7 +48,22 @@ const statusFinalizer = "finalizer.status.devops.dxas90"
 // LearnReconciler reconciles a Status object
 type LearnReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// TracerProvider provides the tracer of the reconcile spans, the global
+	// provider is used when it is nil
+	TracerProvider trace.TracerProvider
+	// Defaults are applied to the fields a Learn leaves empty, the built-in
+	// defaults fill the ones left empty here
+	Defaults configv1alpha1.LearnDefaults
+	// MaxConcurrentReconciles is the number of Learn objects reconciled in parallel
+	MaxConcurrentReconciles int
+	// ReconcileTimeout bounds a reconcile, DefaultReconcileTimeout is used when zero
+	ReconcileTimeout time.Duration
+	// GatewayAPI is true when the cluster served the HTTPRoute CRD when the
+	// operator started, see GatewayAPIInstalled. The HTTPRoutes of spec.gateway
+	// are only created and watched then.
+	GatewayAPI bool
 }
 
 //+kubebuilder:rbac:groups=devops.dxas90,resources=learns,verbs=get;list;watch;create;update;patch;delete
@@ -52,6 +75,10 @@ type LearnReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,58 +90,66 @@ type LearnReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *LearnReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := withReconcileTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+	ctx, span := r.startSpan(ctx, "Reconcile", req.NamespacedName)
+	defer span.End()
+
+	result, err := r.reconcile(ctx, req)
+	recordSpanError(span, err)
+	return result, err
+}
+
+// reconcile runs a single reconciliation of the Learn in req
+func (r *LearnReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	reqLogger := log.FromContext(ctx)
 	// Fetch the OptimalLeadNats instance
 	instance := &devopsv1alpha1.Learn{}
-	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
+	err := r.Client.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			rollouts.forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
-	// TODO Check number of nodes
-	var replicas int32 = 2
-	if instance.Spec.Replicas <= 0 {
-		instance.Spec.Replicas = replicas
-	}
-	if instance.Spec.Image == "" {
-		instance.Spec.Image = "dxas90/learn:latest"
-	}
-
-	if err := r.createResources(ctx, instance, req); err != nil {
-		reqLogger.Error(err, "Failed to create the resource required for the Learn CR")
-		return reconcile.Result{}, err
-	}
-
-	// if err := r.manageResources(instance); err != nil {
-	// 	reqLogger.Error(err, "Failed to manage resource required for the Learn CR")
-	// 	return reconcile.Result{}, err
-	// }
-
-	if err := r.createUpdateCRStatus(ctx, req); err != nil {
-		reqLogger.Error(err, "Failed to create and update the status in the Learn CR")
-		return reconcile.Result{}, err
-	}
+	// The spec hash covers the spec as the user wrote it, before the defaults
+	paused, awaitingApproval := instance.IsPaused(), instance.AwaitsApproval()
+	setDefaults(instance, r.Defaults)
 
+	// A Learn being deleted is torn down, its children are not re-created
 	isMarkedToBeDeleted := instance.GetDeletionTimestamp() != nil
 	if isMarkedToBeDeleted {
+		rollouts.forget(req.NamespacedName)
 		if contains(instance.GetFinalizers(), statusFinalizer) {
 			// Run finalization logic for statusFinalizer. If the
-			// finalization logic fails, don't remove the finalizer so
-			// that we can retry during the next reconciliation.
-			if err := r.finalizeLearn(ctx, instance); err != nil {
+			// finalization logic fails or is still in progress, don't
+			// remove the finalizer so that we can retry during the next
+			// reconciliation.
+			var result ctrl.Result
+			if err := r.traceStep(ctx, req.NamespacedName, "finalizeLearn", "", func(ctx context.Context) error {
+				var err error
+				result, err = r.finalizeLearn(ctx, instance)
+				return err
+			}); err != nil {
+				r.recordWarning(instance, ReasonFinalizeFailed, err)
+				reconcileErrors.WithLabelValues(phaseFinalize).Inc()
 				return ctrl.Result{}, err
 			}
+			if !result.IsZero() || instance.Status.Teardown == nil || instance.Status.Teardown.Phase != devopsv1alpha1.TeardownCompleted {
+				return result, nil
+			}
 
 			// Remove statusFinalizer. Once all finalizers have been
-			// removed, the object will be deleted.
+			// removed, the object will be deleted. The patch leaves out
+			// the defaults set on the spec.
+			patch := client.MergeFrom(instance.DeepCopy())
 			controllerutil.RemoveFinalizer(instance, statusFinalizer)
-			err := r.Update(ctx, instance)
+			err := r.Patch(ctx, instance, patch)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -122,6 +157,71 @@ func (r *LearnReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, nil
 	}
 
+	// A paused Learn, or one whose spec awaits approval, only gets its status updated
+	if paused || awaitingApproval {
+		reqLogger.Info("Skipping the changes of a paused Learn", "paused", paused, "awaitingApproval", awaitingApproval)
+		if err := r.createUpdateCRStatus(ctx, req); err != nil {
+			r.recordWarning(instance, ReasonStatusUpdateFailed, err)
+			reconcileErrors.WithLabelValues(phaseStatus).Inc()
+			return reconcile.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// In Plan mode the changes are only computed and reported
+	if instance.Spec.ReconcileMode == devopsv1alpha1.ReconcilePlan {
+		if err := r.traceStep(ctx, req.NamespacedName, "planChanges", "", func(ctx context.Context) error {
+			changes, err := r.planChanges(ctx, instance)
+			if err != nil {
+				return err
+			}
+			return r.updatePlannedChanges(ctx, req, changes)
+		}); err != nil {
+			reqLogger.Error(err, "Failed to plan the changes of the Learn CR")
+			r.recordWarning(instance, ReasonPlanFailed, err)
+			reconcileErrors.WithLabelValues(phasePlan).Inc()
+			return reconcile.Result{}, err
+		}
+		if err := r.createUpdateCRStatus(ctx, req); err != nil {
+			r.recordWarning(instance, ReasonStatusUpdateFailed, err)
+			reconcileErrors.WithLabelValues(phaseStatus).Inc()
+			return reconcile.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	var results []stepResult
+	createErr := r.traceStep(ctx, req.NamespacedName, "createResources", "", func(ctx context.Context) error {
+		var err error
+		results, err = r.createResources(ctx, instance, req)
+		return err
+	})
+	if createErr != nil {
+		reqLogger.Error(createErr, "Failed to create the resource required for the Learn CR")
+		r.recordWarning(instance, ReasonCreateResourcesFailed, createErr)
+		reconcileErrors.WithLabelValues(phaseCreate).Inc()
+	}
+
+	// The resources that are Ready are managed even when another step failed
+	manageErr := r.traceStep(ctx, req.NamespacedName, "manageResources", "", func(ctx context.Context) error {
+		return r.manageResources(ctx, instance, results)
+	})
+	if manageErr != nil {
+		reqLogger.Error(manageErr, "Failed to manage resource required for the Learn CR")
+		r.recordWarning(instance, ReasonManageResourcesFailed, manageErr)
+		reconcileErrors.WithLabelValues(phaseManage).Inc()
+	}
+	if err := utilerrors.NewAggregate([]error{createErr, manageErr}); err != nil {
+		return r.failed(ctx, req, err)
+	}
+
+	if err := r.createUpdateCRStatus(ctx, req); err != nil {
+		reqLogger.Error(err, "Failed to create and update the status in the Learn CR")
+		r.recordWarning(instance, ReasonStatusUpdateFailed, err)
+		reconcileErrors.WithLabelValues(phaseStatus).Inc()
+		return reconcile.Result{}, err
+	}
+
 	if !contains(instance.GetFinalizers(), statusFinalizer) {
 		if err := r.addFinalizer(ctx, instance); err != nil {
 			return ctrl.Result{}, err
@@ -132,9 +232,25 @@ func (r *LearnReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	return ctrl.Result{}, nil
 }
 
+// failed reports a reconcile that failed with err in the Ready and Conflict
+// conditions of the Learn, when err is made of API errors, and returns how it
+// is retried
+func (r *LearnReconciler) failed(ctx context.Context, req ctrl.Request, err error) (ctrl.Result, error) {
+	if classes := errorClasses(err); len(classes) > 0 {
+		if statusErr := r.updateFailedCondition(ctx, req, classes, err); statusErr != nil {
+			log.FromContext(ctx).Error(statusErr, "Failed to report the failure in the Ready condition", "classes", classes)
+		}
+	}
+	return failureResult(err)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *LearnReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := registerLearnCollector(mgr.GetClient()); err != nil {
+		return err
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		For(&devopsv1alpha1.Learn{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
@@ -144,26 +260,41 @@ func (r *LearnReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&networkingv1.NetworkPolicy{}).
 		Owns(&networkingv1.Ingress{}).
 		Owns(&rbacv1.RoleBinding{}).
-		Complete(r)
+		Owns(&batchv1.Job{})
+	if r.GatewayAPI {
+		// The status of the HTTPRoute feeds the RouteAccepted condition
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(httpRouteGVK)
+		builder = builder.Owns(route)
+	}
+	return builder.Complete(r)
 }
 
-func (r *LearnReconciler) finalizeLearn(ctx context.Context, m *devopsv1alpha1.Learn) error {
+// finalizeLearn tears the app down before the Learn is removed, see teardown.
+// A non-zero result means the teardown is still in progress.
+func (r *LearnReconciler) finalizeLearn(ctx context.Context, m *devopsv1alpha1.Learn) (ctrl.Result, error) {
 	reqLogger := log.FromContext(ctx)
-	// TODO(user): Add the cleanup steps that the operator
-	// needs to do before the CR can be deleted. Examples
-	// of finalizers include performing backups and deleting
-	// resources that are not owned by this CR, like a PVC.
-	reqLogger.Info("Successfully finalized Status")
-	return nil
+	result, err := r.teardown(ctx, m)
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+	if m.Status.Teardown.Phase == devopsv1alpha1.TeardownCompleted {
+		reqLogger.Info("Successfully finalized Learn")
+		if r.Recorder != nil {
+			r.Recorder.Event(m, v1.EventTypeNormal, ReasonFinalized, "Successfully finalized Learn")
+		}
+	}
+	return ctrl.Result{}, nil
 }
 
 func (r *LearnReconciler) addFinalizer(ctx context.Context, m *devopsv1alpha1.Learn) error {
 	reqLogger := log.FromContext(ctx)
 	reqLogger.Info("Adding Finalizer for the Status")
+	patch := client.MergeFrom(m.DeepCopy())
 	controllerutil.AddFinalizer(m, statusFinalizer)
 
-	// Update CR
-	err := r.Update(context.TODO(), m)
+	// Patch CR, leaving out the defaults set on the spec
+	err := r.Patch(ctx, m, patch)
 	if err != nil {
 		reqLogger.Error(err, "Failed to update Learn with finalizer")
 		return err
@@ -171,6 +302,37 @@ func (r *LearnReconciler) addFinalizer(ctx context.Context, m *devopsv1alpha1.Le
 	return nil
 }
 
+// setDefaults fills the spec fields the user left empty with the operator defaults
+func setDefaults(cr *devopsv1alpha1.Learn, defaults configv1alpha1.LearnDefaults) {
+	// TODO Check number of nodes
+	defaults.Default()
+	if cr.Spec.Replicas <= 0 {
+		cr.Spec.Replicas = defaults.Replicas
+	}
+	if cr.Spec.Image == "" {
+		cr.Spec.Image = defaults.Image
+	}
+	cr.Spec.Autoscaling = defaultAutoscaling(cr.Spec.Autoscaling, defaults)
+}
+
+// defaultAutoscaling fills the autoscaler bounds the user left empty with the
+// operator defaults, defaults must have been completed with Default
+func defaultAutoscaling(autoscaling *devopsv1alpha1.AutoscalingSpec, defaults configv1alpha1.LearnDefaults) *devopsv1alpha1.AutoscalingSpec {
+	if autoscaling == nil {
+		autoscaling = &devopsv1alpha1.AutoscalingSpec{}
+	}
+	if autoscaling.MinReplicas <= 0 {
+		autoscaling.MinReplicas = defaults.MinReplicas
+	}
+	if autoscaling.MaxReplicas <= 0 {
+		autoscaling.MaxReplicas = defaults.MaxReplicas
+	}
+	if autoscaling.MaxReplicas < autoscaling.MinReplicas {
+		autoscaling.MaxReplicas = autoscaling.MinReplicas
+	}
+	return autoscaling
+}
+
 func contains(list []string, s string) bool {
 	for _, v := range list {
 		if v == s {
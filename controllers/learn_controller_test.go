@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// The specs run against the API server of envtest. It has no controller
+// manager: Deployments get no pods, their status stays empty and deleted
+// owners are not garbage collected.
+var _ = Describe("LearnReconciler", func() {
+	ctx := context.Background()
+
+	// newLearn creates a Learn called name in the default namespace
+	newLearn := func(name string, mutate func(*devopsv1alpha1.Learn)) *devopsv1alpha1.Learn {
+		learn := &devopsv1alpha1.Learn{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: devopsv1alpha1.LearnSpec{
+				Image:    "dxas90/learn:1.0.0",
+				Replicas: 2,
+			},
+		}
+		if mutate != nil {
+			mutate(learn)
+		}
+		Expect(k8sClient.Create(ctx, learn)).To(Succeed())
+		return learn
+	}
+
+	// get returns a func fetching the object of obj, for Eventually
+	get := func(obj client.Object, name string) func() error {
+		return func() error {
+			return k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, obj)
+		}
+	}
+
+	// updateLearn applies mutate to the live Learn, retrying on conflicts
+	// with the status updates of the reconciler
+	updateLearn := func(name string, mutate func(*devopsv1alpha1.Learn)) {
+		Eventually(func() error {
+			learn := &devopsv1alpha1.Learn{}
+			if err := get(learn, name)(); err != nil {
+				return err
+			}
+			mutate(learn)
+			return k8sClient.Update(ctx, learn)
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+	}
+
+	// deleteLearn deletes the Learn and waits until its finalizer let it go
+	deleteLearn := func(name string) {
+		learn := &devopsv1alpha1.Learn{}
+		Expect(get(learn, name)()).To(Succeed())
+		Expect(k8sClient.Delete(ctx, learn)).To(Succeed())
+		Eventually(func() bool {
+			return errors.IsNotFound(get(&devopsv1alpha1.Learn{}, name)())
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+	}
+
+	It("creates the children of a Learn", func() {
+		learn := newLearn("learn-create", nil)
+		defer deleteLearn(learn.Name)
+
+		for _, child := range []struct {
+			obj  client.Object
+			name string
+		}{
+			{&corev1.ConfigMap{}, "learn-create-conf"},
+			{&corev1.ServiceAccount{}, "learn-create-sa"},
+			{&appsv1.Deployment{}, "learn-create"},
+			{&corev1.Service{}, "learn-create"},
+			{&autoscalingv2beta2.HorizontalPodAutoscaler{}, "learn-create"},
+		} {
+			Eventually(get(child.obj, child.name), eventuallyTimeout, eventuallyInterval).Should(Succeed())
+			Expect(metav1.IsControlledBy(child.obj, learnWithUID(learn))).To(BeTrue(), "%T %s is not controlled by the Learn", child.obj, child.name)
+			Expect(child.obj.GetLabels()).To(HaveKeyWithValue(devopsv1alpha1.LabelOwnedBy, string(learnWithUID(learn).UID)))
+		}
+
+		dep := &appsv1.Deployment{}
+		Expect(get(dep, learn.Name)()).To(Succeed())
+		Expect(dep.Spec.Template.Spec.Containers[0].Image).To(Equal("dxas90/learn:1.0.0"))
+		Expect(dep.Spec.Template.Spec.ServiceAccountName).To(Equal("learn-create-sa"))
+	})
+
+	It("makes the Deployment follow the image and the replicas of the spec", func() {
+		disabled := false
+		learn := newLearn("learn-update", func(learn *devopsv1alpha1.Learn) {
+			// Without an autoscaler the spec owns the replica count
+			learn.Spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{Enabled: &disabled}
+		})
+		defer deleteLearn(learn.Name)
+
+		dep := &appsv1.Deployment{}
+		Eventually(get(dep, learn.Name), eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		updateLearn(learn.Name, func(learn *devopsv1alpha1.Learn) {
+			learn.Spec.Image = "dxas90/learn:2.0.0"
+			learn.Spec.Replicas = 3
+		})
+		Eventually(func() (string, error) {
+			err := get(dep, learn.Name)()
+			if err != nil {
+				return "", err
+			}
+			return dep.Spec.Template.Spec.Containers[0].Image, nil
+		}, eventuallyTimeout, eventuallyInterval).Should(Equal("dxas90/learn:2.0.0"))
+		Eventually(func() (int32, error) {
+			err := get(dep, learn.Name)()
+			if err != nil || dep.Spec.Replicas == nil {
+				return 0, err
+			}
+			return *dep.Spec.Replicas, nil
+		}, eventuallyTimeout, eventuallyInterval).Should(Equal(int32(3)))
+	})
+
+	It("re-creates deleted children", func() {
+		learn := newLearn("learn-drift", nil)
+		defer deleteLearn(learn.Name)
+
+		for _, child := range []client.Object{&corev1.Service{}, &corev1.ConfigMap{}} {
+			name := learn.Name
+			if _, ok := child.(*corev1.ConfigMap); ok {
+				name = learn.Name + "-conf"
+			}
+			Eventually(get(child, name), eventuallyTimeout, eventuallyInterval).Should(Succeed())
+			deleted := child.GetUID()
+			Expect(k8sClient.Delete(ctx, child)).To(Succeed())
+
+			Eventually(func() (types.UID, error) {
+				err := get(child, name)()
+				return child.GetUID(), err
+			}, eventuallyTimeout, eventuallyInterval).ShouldNot(Or(BeEmpty(), Equal(deleted)))
+		}
+	})
+
+	It("removes the finalizer once the Learn is torn down", func() {
+		learn := newLearn("learn-finalize", nil)
+
+		Eventually(func() ([]string, error) {
+			live := &devopsv1alpha1.Learn{}
+			err := get(live, learn.Name)()
+			return live.Finalizers, err
+		}, eventuallyTimeout, eventuallyInterval).Should(ContainElement(statusFinalizer))
+
+		deleteLearn(learn.Name)
+
+		// The HorizontalPodAutoscaler is removed by the teardown
+		Eventually(func() bool {
+			return errors.IsNotFound(get(&autoscalingv2beta2.HorizontalPodAutoscaler{}, learn.Name)())
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+	})
+
+	It("reports the status transitions of a Learn", func() {
+		learn := newLearn("learn-status", nil)
+		defer deleteLearn(learn.Name)
+
+		live := &devopsv1alpha1.Learn{}
+		Eventually(func() (bool, error) {
+			err := get(live, learn.Name)()
+			return meta.IsStatusConditionTrue(live.Status.Conditions, devopsv1alpha1.ConditionReady), err
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+		Expect(live.Status.Status).To(Equal(statusOk))
+		Expect(live.Status.Resources).NotTo(BeEmpty())
+		for _, resource := range live.Status.Resources {
+			Expect(resource.State).To(BeElementOf(devopsv1alpha1.ResourceReady, devopsv1alpha1.ResourceDisabled), "%s %s", resource.Kind, resource.Name)
+		}
+
+		updateLearn(learn.Name, func(learn *devopsv1alpha1.Learn) {
+			learn.Annotations = map[string]string{devopsv1alpha1.AnnotationPaused: "true"}
+		})
+		Eventually(func() (*metav1.Condition, error) {
+			err := get(live, learn.Name)()
+			return meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionPaused), err
+		}, eventuallyTimeout, eventuallyInterval).ShouldNot(BeNil())
+
+		updateLearn(learn.Name, func(learn *devopsv1alpha1.Learn) {
+			delete(learn.Annotations, devopsv1alpha1.AnnotationPaused)
+		})
+		Eventually(func() (*metav1.Condition, error) {
+			err := get(live, learn.Name)()
+			return meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionPaused), err
+		}, eventuallyTimeout, eventuallyInterval).Should(BeNil())
+	})
+})
+
+// learnWithUID returns the live Learn of learn, which carries the UID the API
+// server gave it
+func learnWithUID(learn *devopsv1alpha1.Learn) *devopsv1alpha1.Learn {
+	live := &devopsv1alpha1.Learn{}
+	Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(learn), live)).To(Succeed())
+	return live
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	goerrors "errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ErrorClass groups the API errors by what the operator does about them. The
+// classes are used as the reason of the Ready condition of a failing reconcile.
+type ErrorClass string
+
+const (
+	// ErrorNotFound is a resource that disappeared between two calls
+	ErrorNotFound ErrorClass = "NotFound"
+	// ErrorForbidden is an RBAC denial, it lasts until the permissions of the
+	// operator are fixed
+	ErrorForbidden ErrorClass = "Forbidden"
+	// ErrorConflict is a write based on a stale read, a create of a resource
+	// the cache did not see yet, or one waiting for the resource it replaces
+	// to be deleted
+	ErrorConflict ErrorClass = "Conflict"
+	// ErrorInvalid is a resource the API server rejects, it lasts until the
+	// spec is fixed
+	ErrorInvalid ErrorClass = "Invalid"
+	// ErrorTransient is a timeout or an unavailable API server
+	ErrorTransient ErrorClass = "Transient"
+	// ErrorNotOwned is an existing resource the adoption policy refuses to
+	// take over, it lasts until the resource or the policy changes
+	ErrorNotOwned ErrorClass = "NotOwned"
+)
+
+// persistentErrorBackoff is how long a reconcile failing on an error that
+// needs a human to act, such as ErrorForbidden, waits before it is retried
+const persistentErrorBackoff = 5 * time.Minute
+
+// ResourceError is an API error on a resource, with the call, the resource
+// and the class of the error
+type ResourceError struct {
+	Verb  string
+	Kind  string
+	Name  string
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", e.Verb, e.Kind, e.Name, e.Err)
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// resourceError wraps the error of verb on the resource kind/name, nil when
+// err is nil. Errors that are not API errors are returned as they are.
+func resourceError(verb, kind, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	class := classifyError(err)
+	if class == "" {
+		return err
+	}
+	return &ResourceError{Verb: verb, Kind: kind, Name: name, Class: class, Err: err}
+}
+
+// classifyError returns the class of the API error err, empty when err is not
+// an API error, a cancelled context for instance
+func classifyError(err error) ErrorClass {
+	var resourceErr *ResourceError
+	if goerrors.As(err, &resourceErr) {
+		return resourceErr.Class
+	}
+	var notOwned *NotOwnedError
+	if goerrors.As(err, &notOwned) {
+		return ErrorNotOwned
+	}
+	switch {
+	case errors.IsNotFound(err):
+		return ErrorNotFound
+	case errors.IsForbidden(err), errors.IsUnauthorized(err):
+		return ErrorForbidden
+	case errors.IsConflict(err), errors.IsAlreadyExists(err):
+		return ErrorConflict
+	case errors.IsInvalid(err), errors.IsBadRequest(err):
+		return ErrorInvalid
+	case errors.IsServerTimeout(err), errors.IsTimeout(err), errors.IsTooManyRequests(err),
+		errors.IsServiceUnavailable(err), errors.IsInternalError(err), errors.IsUnexpectedServerError(err):
+		return ErrorTransient
+	}
+	return ""
+}
+
+// errorClasses returns the classes of the errors in err, which may aggregate
+// the errors of several steps. It is empty when one of them is not an API error.
+func errorClasses(err error) []ErrorClass {
+	errs := []error{err}
+	var aggregate utilerrors.Aggregate
+	if goerrors.As(err, &aggregate) {
+		errs = utilerrors.Flatten(aggregate).Errors()
+	}
+	classes := make([]ErrorClass, 0, len(errs))
+	for _, err := range errs {
+		class := classifyError(err)
+		if class == "" {
+			return nil
+		}
+		classes = append(classes, class)
+	}
+	return classes
+}
+
+// failureReason returns the reason of the Ready condition of a reconcile that
+// failed with the classes, the one asking for a human first
+func failureReason(classes []ErrorClass) ErrorClass {
+	for _, class := range []ErrorClass{ErrorForbidden, ErrorNotOwned, ErrorInvalid, ErrorConflict, ErrorNotFound, ErrorTransient} {
+		for _, c := range classes {
+			if c == class {
+				return class
+			}
+		}
+	}
+	return ""
+}
+
+// failureResult returns how a reconcile that failed with err is retried.
+// Conflicts, vanished resources and transient errors are requeued with the
+// backoff of the rate limiter of the controller, errors that only a human can
+// fix are retried after persistentErrorBackoff. Errors that are not API
+// errors are returned, the controller retries them with its backoff too.
+func failureResult(err error) (ctrl.Result, error) {
+	classes := errorClasses(err)
+	if len(classes) == 0 {
+		return ctrl.Result{}, err
+	}
+	for _, class := range classes {
+		if class != ErrorForbidden && class != ErrorInvalid && class != ErrorNotOwned {
+			return ctrl.Result{Requeue: true}, nil
+		}
+	}
+	return ctrl.Result{RequeueAfter: persistentErrorBackoff}, nil
+}
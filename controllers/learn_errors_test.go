@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+func TestClassifyError(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	for _, tt := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{errors.NewNotFound(gr, "learn"), ErrorNotFound},
+		{errors.NewForbidden(gr, "learn", goerrors.New("denied")), ErrorForbidden},
+		{errors.NewUnauthorized("expired"), ErrorForbidden},
+		{errors.NewConflict(gr, "learn", goerrors.New("stale")), ErrorConflict},
+		{errors.NewAlreadyExists(gr, "learn"), ErrorConflict},
+		{errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "learn", nil), ErrorInvalid},
+		{errors.NewServiceUnavailable("down"), ErrorTransient},
+		{errors.NewTimeoutError("slow", 1), ErrorTransient},
+		{errors.NewTooManyRequests("busy", 1), ErrorTransient},
+		{errors.NewInternalError(goerrors.New("boom")), ErrorTransient},
+		{resourceError("get", "Deployment", "learn", errors.NewServiceUnavailable("down")), ErrorTransient},
+		{context.Canceled, ""},
+	} {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFailureResult(t *testing.T) {
+	gr := schema.GroupResource{Resource: "services"}
+	forbidden := resourceError("create", "Service", "learn", errors.NewForbidden(gr, "learn", goerrors.New("denied")))
+	unavailable := resourceError("get", "ConfigMap", "learn-conf", errors.NewServiceUnavailable("down"))
+
+	for _, tt := range []struct {
+		name    string
+		err     error
+		want    ctrl.Result
+		wantErr bool
+	}{
+		{"forbidden", forbidden, ctrl.Result{RequeueAfter: persistentErrorBackoff}, false},
+		{"conflict", errors.NewConflict(gr, "learn", goerrors.New("stale")), ctrl.Result{Requeue: true}, false},
+		// The transient error may go away before the RBAC denial is fixed
+		{"forbidden and transient", utilerrors.NewAggregate([]error{forbidden, unavailable}), ctrl.Result{Requeue: true}, false},
+		{"not an API error", goerrors.New("boom"), ctrl.Result{}, true},
+	} {
+		got, err := failureResult(tt.err)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: failureResult() = %+v, %v, want %+v and an error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if got := failureReason(errorClasses(utilerrors.NewAggregate([]error{unavailable, forbidden}))); got != ErrorForbidden {
+		t.Errorf("failureReason() = %q, want %q", got, ErrorForbidden)
+	}
+}
+
+// failingClient returns err from the verb calls on the objects of the type of obj
+type failingClient struct {
+	client.Client
+	obj  client.Object
+	verb string
+	err  error
+}
+
+func (c *failingClient) fails(verb string, obj client.Object) bool {
+	return verb == c.verb && reflect.TypeOf(obj) == reflect.TypeOf(c.obj)
+}
+
+func (c *failingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if c.fails("get", obj) {
+		return c.err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *failingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if c.fails("create", obj) {
+		return c.err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *failingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if c.fails("update", obj) {
+		return c.err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func TestEnsureCreatedOnlyCreatesWhenNotFound(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"}}
+	r := newFakeReconciler(learn)
+	counting := &writeCountingClient{Client: &failingClient{
+		Client: r.Client, obj: &corev1.Service{}, verb: "get",
+		err: errors.NewServiceUnavailable("the API server is restarting"),
+	}}
+	r.Client = counting
+
+	err := r.createServiceCR(context.Background(), learn)
+	var resourceErr *ResourceError
+	if !goerrors.As(err, &resourceErr) || resourceErr.Class != ErrorTransient || resourceErr.Kind != "Service" || resourceErr.Name != "learn-sample" {
+		t.Fatalf("createServiceCR() error = %v, want a Transient ResourceError on Service learn-sample", err)
+	}
+	if len(counting.writes) > 0 {
+		t.Errorf("createServiceCR() wrote %v after a failed Get, want no write", counting.writes)
+	}
+}
+
+func TestReconcileReportsForbidden(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+	r := newFakeReconciler(learn)
+	r.Client = &failingClient{
+		Client: r.Client, obj: &appsv1.Deployment{}, verb: "create",
+		err: errors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "learn-sample", goerrors.New("RBAC denied")),
+	}
+
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v, want the failure reported in the status", err)
+	}
+	if result.RequeueAfter != persistentErrorBackoff {
+		t.Errorf("Reconcile() = %+v, want a requeue after %v", result, persistentErrorBackoff)
+	}
+
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(context.Background(), key, live); err != nil {
+		t.Fatal(err)
+	}
+	ready := meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != string(ErrorForbidden) {
+		t.Fatalf("Ready condition = %+v, want False with reason %s", ready, ErrorForbidden)
+	}
+	if want := "create Deployment learn-sample: "; len(ready.Message) < len(want) || ready.Message[:len(want)] != want {
+		t.Errorf("Ready condition message = %q, want it to start with %q", ready.Message, want)
+	}
+}
+
+func TestReconcileManagesReadyResourcesWhenAStepFails(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image: "dxas90/learn:1.0.0", Replicas: 2,
+			Monitoring: &devopsv1alpha1.MonitoringSpec{Enabled: true, Port: 9090, Path: "/metrics"},
+		},
+	}
+	r := newFakeReconciler(learn)
+	installServiceMonitorCRD(r)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	live := getLearn(t, r, key)
+	live.Spec.Image = "dxas90/learn:2.0.0"
+	if err := r.Update(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	// The ServiceMonitor step fails, the Deployment step is still Ready
+	r.Client = &failingClient{
+		Client: r.Client, obj: &unstructured.Unstructured{}, verb: "get",
+		err: errors.NewForbidden(schema.GroupResource{Group: "monitoring.coreos.com", Resource: "servicemonitors"}, "learn-sample", goerrors.New("RBAC denied")),
+	}
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil || result.RequeueAfter != persistentErrorBackoff {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue after %v", result, err, persistentErrorBackoff)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if got := dep.Spec.Template.Spec.Containers[0].Image; got != "dxas90/learn:2.0.0" {
+		t.Errorf("Deployment image = %s, want the new image set although the ServiceMonitor step failed", got)
+	}
+}
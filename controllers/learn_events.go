@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons used on the Events recorded against a Learn, a Status or a Crypto. They are part of the
+// operator's observable behaviour, so keep them stable.
+const (
+	// ReasonCreated is recorded when an owned resource is created
+	ReasonCreated = "Created"
+	// ReasonUpdated is recorded when an owned resource is updated
+	ReasonUpdated = "Updated"
+	// ReasonDeleted is recorded when an owned resource is deleted
+	ReasonDeleted = "Deleted"
+	// ReasonFinalized is recorded when the finalizer logic has completed
+	ReasonFinalized = "Finalized"
+
+	// ReasonCreateResourcesFailed is recorded when createResources fails
+	ReasonCreateResourcesFailed = "CreateResourcesFailed"
+	// ReasonManageResourcesFailed is recorded when manageResources fails
+	ReasonManageResourcesFailed = "ManageResourcesFailed"
+	// ReasonStatusUpdateFailed is recorded when createUpdateCRStatus fails
+	ReasonStatusUpdateFailed = "StatusUpdateFailed"
+	// ReasonFinalizeFailed is recorded when finalizeLearn fails
+	ReasonFinalizeFailed = "FinalizeFailed"
+	// ReasonPlanFailed is recorded when planChanges fails
+	ReasonPlanFailed = "PlanFailed"
+)
+
+// owned returns the client writing the resources owned by a Learn
+func (r *LearnReconciler) owned() ownedClient {
+	return ownedClient{Client: r.Client, scheme: r.Scheme, recorder: r.Recorder}
+}
+
+// createOwned creates obj and records a Normal event on the Learn that owns it
+func (r *LearnReconciler) createOwned(ctx context.Context, cr *devopsv1alpha1.Learn, obj client.Object) error {
+	return r.owned().create(ctx, cr, obj)
+}
+
+// updateOwned updates obj and records a Normal event on the Learn that owns it
+func (r *LearnReconciler) updateOwned(ctx context.Context, cr *devopsv1alpha1.Learn, obj client.Object) error {
+	return r.owned().update(ctx, cr, obj)
+}
+
+// deleteOwned deletes obj and records a Normal event on the Learn that owns it
+func (r *LearnReconciler) deleteOwned(ctx context.Context, cr *devopsv1alpha1.Learn, obj client.Object) error {
+	return r.owned().delete(ctx, cr, obj)
+}
+
+// recordWarning records a Warning event on the Learn for a failed reconcile phase
+func (r *LearnReconciler) recordWarning(cr *devopsv1alpha1.Learn, reason string, err error) {
+	r.owned().recordWarning(cr, reason, err)
+}
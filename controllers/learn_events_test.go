@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// recordedEvents drains the events recorded by the fake recorder of r
+func recordedEvents(r *LearnReconciler) []string {
+	var events []string
+	recorder := r.Recorder.(*record.FakeRecorder)
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestOwnedClientRecordsEvents(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"}}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	cm := NewConfigMapCR(learn, map[string]string{"key": "value"}, r.Scheme)
+
+	if err := r.createOwned(ctx, learn, cm); err != nil {
+		t.Fatalf("createOwned() error = %v", err)
+	}
+	cm.Data["key"] = "other"
+	if err := r.updateOwned(ctx, learn, cm); err != nil {
+		t.Fatalf("updateOwned() error = %v", err)
+	}
+	if err := r.deleteOwned(ctx, learn, cm); err != nil {
+		t.Fatalf("deleteOwned() error = %v", err)
+	}
+
+	want := []string{
+		"Normal Created Created ConfigMap learn-sample-conf",
+		"Normal Updated Updated ConfigMap learn-sample-conf",
+		"Normal Deleted Deleted ConfigMap learn-sample-conf",
+	}
+	if got := recordedEvents(r); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestOwnedClientRecordsNoEventOnFailure(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"}}
+	r := newFakeReconciler(learn)
+	r.Client = &failingClient{Client: r.Client, obj: &corev1.ConfigMap{}, verb: "create", err: errors.NewServiceUnavailable("the API server is restarting")}
+
+	if err := r.createOwned(context.Background(), learn, NewConfigMapCR(learn, nil, r.Scheme)); err == nil {
+		t.Fatal("createOwned() error = nil, want the error of the client")
+	}
+	if got := recordedEvents(r); len(got) != 0 {
+		t.Errorf("events = %q, want none for a failed write", got)
+	}
+}
+
+func TestReconcileRecordsWarnings(t *testing.T) {
+	unavailable := errors.NewServiceUnavailable("the API server is restarting")
+	for _, tt := range []struct {
+		name   string
+		failOn func(r *LearnReconciler) *failingClient
+		want   string
+	}{
+		{
+			name: "create",
+			failOn: func(r *LearnReconciler) *failingClient {
+				return &failingClient{Client: r.Client, obj: &corev1.ConfigMap{}, verb: "create", err: unavailable}
+			},
+			want: ReasonCreateResourcesFailed,
+		},
+		{
+			name: "manage",
+			failOn: func(r *LearnReconciler) *failingClient {
+				// The image drifted, correcting it is the first write of manageResources
+				dep := &appsv1.Deployment{}
+				key := types.NamespacedName{Name: "learn-sample", Namespace: "default"}
+				if err := r.Get(context.Background(), key, dep); err != nil {
+					t.Fatal(err)
+				}
+				dep.Spec.Template.Spec.Containers[0].Image = "dxas90/learn:0.9.0"
+				if err := r.Update(context.Background(), dep); err != nil {
+					t.Fatal(err)
+				}
+				return &failingClient{Client: r.Client, obj: &appsv1.Deployment{}, verb: "update", err: unavailable}
+			},
+			want: ReasonManageResourcesFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			learn := &devopsv1alpha1.Learn{
+				ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid", Finalizers: []string{statusFinalizer}},
+				Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+			}
+			r := newFakeReconciler(learn)
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}}
+			if tt.name != "create" {
+				if _, err := r.Reconcile(context.Background(), req); err != nil {
+					t.Fatalf("first Reconcile() error = %v", err)
+				}
+			}
+			r.Client = tt.failOn(r)
+			recordedEvents(r)
+
+			// The failure is retried with a backoff rather than returned
+			if result, _ := r.Reconcile(context.Background(), req); !result.Requeue && result.RequeueAfter == 0 {
+				t.Errorf("Reconcile() result = %+v, want a retry", result)
+			}
+			var warnings []string
+			for _, event := range recordedEvents(r) {
+				if strings.HasPrefix(event, corev1.EventTypeWarning+" ") {
+					warnings = append(warnings, event)
+				}
+			}
+			if len(warnings) != 1 || !strings.HasPrefix(warnings[0], corev1.EventTypeWarning+" "+tt.want+" ") || !strings.Contains(warnings[0], "the API server is restarting") {
+				t.Errorf("warnings = %q, want one %s Warning with the error of the client", warnings, tt.want)
+			}
+		})
+	}
+}
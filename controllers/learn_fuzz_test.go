@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// writeCountingClient records the writes made through it
+type writeCountingClient struct {
+	client.Client
+	writes []string
+}
+
+func (c *writeCountingClient) record(verb string, obj client.Object) {
+	c.writes = append(c.writes, fmt.Sprintf("%s %T %s", verb, obj, obj.GetName()))
+}
+
+func (c *writeCountingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.record("create", obj)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.record("update", obj)
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.record("patch", obj)
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *writeCountingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.record("delete", obj)
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Status() client.StatusWriter {
+	return &writeCountingStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+// writeCountingStatusWriter records the status writes in its client
+type writeCountingStatusWriter struct {
+	client.StatusWriter
+	client *writeCountingClient
+}
+
+func (w *writeCountingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.client.record("update status", obj)
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w *writeCountingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	w.client.record("patch status", obj)
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// fuzzServiceTypes are the Service types a fuzzed spec picks from
+var fuzzServiceTypes = []devopsv1alpha1.ServiceType{
+	devopsv1alpha1.ServiceClusterIP,
+	devopsv1alpha1.ServiceNodePort,
+	devopsv1alpha1.ServiceLoadBalancer,
+	devopsv1alpha1.ServiceHeadless,
+}
+
+// fuzzPortNames are the names of the Service ports a fuzzed spec declares,
+// metrics is also the name of the port added for spec.monitoring
+var fuzzPortNames = []string{"http", "metrics", "admin"}
+
+// fuzzLabelValue keeps the characters of s a label value allows, trimmed to
+// start and end with an alphanumeric character
+func fuzzLabelValue(s string, maxLength int) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(s))
+	if len(s) > maxLength {
+		s = s[:maxLength]
+	}
+	return strings.Trim(s, ".-")
+}
+
+// fuzzLearnSpec returns a valid LearnSpec built from the fuzzed values
+func fuzzLearnSpec(tag string, replicas uint8, autoscaling bool, minReplicas, maxReplicas uint8, monitoring bool, port uint16,
+	nameOverride, label, annotation string, serviceType, ports uint8, gateway bool) devopsv1alpha1.LearnSpec {
+	// Keep the characters the image pattern of the CRD allows
+	tag = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(tag))
+	spec := devopsv1alpha1.LearnSpec{
+		// 0 leaves the replicas to the defaults
+		Replicas: int32(replicas % 16),
+	}
+	if tag != "" {
+		spec.Image = "dxas90/learn:" + tag
+	}
+	if autoscaling || minReplicas%2 == 0 {
+		spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{
+			Enabled:     &autoscaling,
+			MinReplicas: int32(minReplicas % 16),
+			MaxReplicas: int32(maxReplicas % 16),
+		}
+	}
+	scrapePort := int32(port%60000) + 1024
+	if monitoring {
+		spec.Monitoring = &devopsv1alpha1.MonitoringSpec{Enabled: true, Port: scrapePort}
+	}
+
+	// The name pattern of the CRD starts with a letter and ends with an
+	// alphanumeric character
+	nameOverride = strings.TrimLeft(strings.ReplaceAll(fuzzLabelValue(nameOverride, 58), ".", ""), "-0123456789")
+	spec.NameOverride = strings.TrimRight(nameOverride, "-")
+	if value := fuzzLabelValue(label, 63); value != "" {
+		// The app label of the operator wins over the common one
+		spec.CommonLabels = map[string]string{"team": value, "app": value}
+	}
+	if annotation = strings.ToValidUTF8(annotation, ""); annotation != "" {
+		spec.CommonAnnotations = map[string]string{"example.com/note": annotation}
+	}
+
+	if serviceType%5 != 0 {
+		spec.Service = &devopsv1alpha1.ServiceSpec{Type: fuzzServiceTypes[serviceType%5-1]}
+		// Up to three ports, the last one serving the metrics when declared
+		for i := 0; i < int(ports%4); i++ {
+			servicePort := devopsv1alpha1.ServicePort{Name: fuzzPortNames[i], Port: 8080 + int32(i)}
+			if i == 2 {
+				targetPort := intstr.FromInt(int(scrapePort))
+				servicePort.TargetPort = &targetPort
+			}
+			spec.Service.Ports = append(spec.Service.Ports, servicePort)
+		}
+	}
+	if gateway {
+		spec.Gateway = &devopsv1alpha1.GatewaySpec{
+			ParentRefs: []devopsv1alpha1.GatewayParentRef{{Name: "public", Namespace: "infra"}},
+		}
+		if value := fuzzLabelValue(label, 63); value != "" {
+			spec.Gateway.Hostnames = []string{value + ".example.com"}
+		}
+	}
+	return spec
+}
+
+// FuzzReconcileIdempotent reconciles a Learn with a fuzzed spec twice and
+// checks that the second reconcile writes nothing and that the resources of
+// the Learn are owned by it and select its pods
+func FuzzReconcileIdempotent(f *testing.F) {
+	f.Add("1.0.0", uint8(2), true, uint8(1), uint8(5), false, uint16(0), "", "", "", uint8(0), uint8(0), false)
+	f.Add("", uint8(0), false, uint8(0), uint8(0), false, uint16(0), "", "", "", uint8(0), uint8(0), false)
+	f.Add("latest", uint8(15), true, uint8(9), uint8(3), true, uint16(9090), "web-app", "payments", "owned by the payments team", uint8(3), uint8(2), true)
+	f.Add("v2", uint8(1), false, uint8(4), uint8(4), true, uint16(8080), "", "", "", uint8(4), uint8(3), false)
+
+	f.Fuzz(func(t *testing.T, tag string, replicas uint8, autoscaling bool, minReplicas, maxReplicas uint8, monitoring bool, port uint16,
+		nameOverride, label, annotation string, serviceType, ports uint8, gateway bool) {
+		learn := &devopsv1alpha1.Learn{
+			ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Namespace: "default", UID: "fuzz-uid"},
+			Spec: fuzzLearnSpec(tag, replicas, autoscaling, minReplicas, maxReplicas, monitoring, port,
+				nameOverride, label, annotation, serviceType, ports, gateway),
+		}
+		r := newFakeReconciler(learn)
+		r.GatewayAPI = true
+		counting := &writeCountingClient{Client: r.Client}
+		r.Client = counting
+
+		ctx := context.Background()
+		key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("first Reconcile() error = %v", err)
+		}
+		counting.writes = nil
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("second Reconcile() error = %v", err)
+		}
+		if len(counting.writes) > 0 {
+			t.Errorf("second Reconcile() of %+v wrote %v, want no write", learn.Spec, counting.writes)
+		}
+
+		checkOwnedResources(t, r, learn)
+	})
+}
+
+// checkOwnedResources checks that the resources in the namespace of learn are
+// controlled by it and carry its labels and annotations, that the selectors
+// pick its pods and that its Service is of the type and has the ports asked for
+func checkOwnedResources(t *testing.T, r *LearnReconciler, learn *devopsv1alpha1.Learn) {
+	t.Helper()
+	ctx := context.Background()
+	// Check against the spec in the cluster, the caller may have changed it since
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(learn), live); err != nil {
+		t.Fatal(err)
+	}
+	learn = live
+	appLabels := labels.Set{"app": learn.Name, "devops": learn.Name}
+	for k, v := range learn.Spec.CommonLabels {
+		if _, operator := appLabels[k]; !operator {
+			appLabels[k] = v
+		}
+	}
+
+	checkObject := func(obj client.Object) {
+		t.Helper()
+		if !metav1.IsControlledBy(obj, learn) {
+			t.Errorf("%T %s is not controlled by the Learn: %v", obj, obj.GetName(), obj.GetOwnerReferences())
+		}
+		if !appLabels.AsSelector().Matches(labels.Set(obj.GetLabels())) || obj.GetLabels()[devopsv1alpha1.LabelOwnedBy] != string(learn.UID) {
+			t.Errorf("%T %s labels = %v, want the app labels, the common labels and the ownership label", obj, obj.GetName(), obj.GetLabels())
+		}
+		for k, v := range learn.Spec.CommonAnnotations {
+			if obj.GetAnnotations()[k] != v {
+				t.Errorf("%T %s annotations = %v, want the common annotations", obj, obj.GetName(), obj.GetAnnotations())
+			}
+		}
+	}
+	for _, list := range []client.ObjectList{
+		&corev1.ConfigMapList{},
+		&corev1.ServiceAccountList{},
+		&corev1.ServiceList{},
+		&appsv1.DeploymentList{},
+		&autoscalingv2beta2.HorizontalPodAutoscalerList{},
+	} {
+		if err := r.List(ctx, list, client.InNamespace(learn.Namespace)); err != nil {
+			t.Fatal(err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			checkObject(item.(client.Object))
+		}
+	}
+
+	key := types.NamespacedName{Name: learn.AppName(), Namespace: learn.Namespace}
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	switch err := r.Get(ctx, key, route); {
+	case learn.Spec.Gateway == nil && !errors.IsNotFound(err):
+		t.Errorf("HTTPRoute get error = %v, want none without a gateway", err)
+	case learn.Spec.Gateway != nil && err != nil:
+		t.Errorf("HTTPRoute not created for the gateway: %v", err)
+	case learn.Spec.Gateway != nil:
+		checkObject(route)
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podLabels := labels.Set(dep.Spec.Template.Labels)
+	if !selector.Matches(podLabels) {
+		t.Errorf("Deployment selector %s does not pick its pods labelled %v", selector, podLabels)
+	}
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if !labels.SelectorFromSet(svc.Spec.Selector).Matches(podLabels) {
+		t.Errorf("Service selector %v does not pick the pods labelled %v", svc.Spec.Selector, podLabels)
+	}
+
+	serviceType, headless := corev1.ServiceTypeClusterIP, false
+	if spec := learn.Spec.Service; spec != nil {
+		switch spec.Type {
+		case devopsv1alpha1.ServiceHeadless:
+			headless = true
+		case devopsv1alpha1.ServiceNodePort, devopsv1alpha1.ServiceLoadBalancer:
+			serviceType = corev1.ServiceType(spec.Type)
+		}
+	}
+	if svc.Spec.Type != serviceType || (svc.Spec.ClusterIP == corev1.ClusterIPNone) != headless {
+		t.Errorf("Service type = %s, cluster IP = %q, want type %s, headless %v", svc.Spec.Type, svc.Spec.ClusterIP, serviceType, headless)
+	}
+	names := map[string]bool{}
+	for _, port := range svc.Spec.Ports {
+		if names[port.Name] {
+			t.Errorf("Service ports = %v, want unique names", svc.Spec.Ports)
+		}
+		names[port.Name] = true
+	}
+	if learn.Spec.Service != nil {
+		for _, port := range learn.Spec.Service.Ports {
+			if !names[port.Name] {
+				t.Errorf("Service ports = %v, want the declared port %s", svc.Spec.Ports, port.Name)
+			}
+		}
+	}
+}
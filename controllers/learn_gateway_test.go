@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// gatewayLearn returns a Learn routed by the public Gateway of the infra namespace
+func gatewayLearn() *devopsv1alpha1.Learn {
+	weight := int32(10)
+	return &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image:    "dxas90/learn:1.0.0",
+			Replicas: 2,
+			Gateway: &devopsv1alpha1.GatewaySpec{
+				ParentRefs: []devopsv1alpha1.GatewayParentRef{{Name: "public", Namespace: "infra"}},
+				Hostnames:  []string{"learn.example.com"},
+				Rules: []devopsv1alpha1.RouteRule{{
+					BackendRefs: []devopsv1alpha1.RouteBackendRef{{}, {Name: "learn-canary", Weight: &weight}},
+					Timeout:     "5s",
+				}},
+			},
+		},
+	}
+}
+
+// setRouteParentStatus writes the status a Gateway controller would write on the HTTPRoute
+func setRouteParentStatus(t *testing.T, r *LearnReconciler, conditions ...interface{}) {
+	t.Helper()
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "learn-sample", Namespace: "default"}, route); err != nil {
+		t.Fatal(err)
+	}
+	route.Object["status"] = map[string]interface{}{"parents": []interface{}{map[string]interface{}{
+		"controllerName": "example.com/gateway-controller",
+		"parentRef":      map[string]interface{}{"group": httpRouteGVK.Group, "kind": "Gateway", "name": "public", "namespace": "infra"},
+		"conditions":     conditions,
+	}}}
+	if err := r.Update(context.Background(), route); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// routeStatusCondition returns a condition of the status of an HTTPRoute
+func routeStatusCondition(conditionType string, status metav1.ConditionStatus, reason string) interface{} {
+	return map[string]interface{}{
+		"type":               conditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            reason,
+		"lastTransitionTime": "2021-06-01T00:00:00Z",
+	}
+}
+
+func TestReconcileRoutesGateway(t *testing.T) {
+	learn := gatewayLearn()
+	r := newFakeReconciler(learn)
+	r.GatewayAPI = true
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+	acceptance := func() *metav1.Condition {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		live := &devopsv1alpha1.Learn{}
+		if err := r.Get(ctx, key, live); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionRouteAccepted)
+	}
+
+	if c := acceptance(); c == nil || c.Status != metav1.ConditionUnknown || c.Reason != "Pending" {
+		t.Fatalf("RouteAccepted condition = %+v, want Unknown while the Gateway has not reported", c)
+	}
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	if err := r.Get(ctx, key, route); err != nil {
+		t.Fatalf("HTTPRoute not created: %v", err)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	if len(rules) != 1 {
+		t.Fatalf("HTTPRoute rules = %v, want one", rules)
+	}
+	backends, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "backendRefs")
+	if len(backends) != 2 {
+		t.Fatalf("HTTPRoute backendRefs = %v, want two", backends)
+	}
+	app, canary := backends[0].(map[string]interface{}), backends[1].(map[string]interface{})
+	if app["name"] != "learn-sample" || app["port"] != int64(8080) || app["weight"] != int64(1) || canary["weight"] != int64(10) {
+		t.Errorf("HTTPRoute backendRefs = %v, want the Service of the app on 8080 and the canary weighted 10", backends)
+	}
+	if !metav1.IsControlledBy(route, learn) || route.GetLabels()[devopsv1alpha1.LabelOwnedBy] != string(learn.UID) {
+		t.Errorf("HTTPRoute owners = %v, labels = %v, want it owned by the Learn", route.GetOwnerReferences(), route.GetLabels())
+	}
+
+	setRouteParentStatus(t, r,
+		routeStatusCondition("Accepted", metav1.ConditionTrue, "Accepted"),
+		routeStatusCondition("ResolvedRefs", metav1.ConditionTrue, "ResolvedRefs"))
+	if c := acceptance(); c == nil || c.Status != metav1.ConditionTrue {
+		t.Errorf("RouteAccepted condition = %+v, want True once the Gateway accepted the route", c)
+	}
+
+	setRouteParentStatus(t, r,
+		routeStatusCondition("Accepted", metav1.ConditionTrue, "Accepted"),
+		routeStatusCondition("ResolvedRefs", metav1.ConditionFalse, "BackendNotFound"))
+	if c := acceptance(); c == nil || c.Status != metav1.ConditionFalse || c.Reason != "BackendNotFound" {
+		t.Errorf("RouteAccepted condition = %+v, want False with the reason of the Gateway", c)
+	}
+
+	// Removing the gateway prunes the route and its condition
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	live.Spec.Gateway = nil
+	if err := r.Update(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	if c := acceptance(); c != nil {
+		t.Errorf("RouteAccepted condition = %+v, want none without a gateway", c)
+	}
+	if err := r.Get(ctx, key, route); !errors.IsNotFound(err) {
+		t.Errorf("HTTPRoute still exists after the gateway was removed, error = %v", err)
+	}
+}
+
+func TestReconcileWithoutGatewayAPI(t *testing.T) {
+	learn := gatewayLearn()
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	live := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	c := meta.FindStatusCondition(live.Status.Conditions, devopsv1alpha1.ConditionRouteAccepted)
+	if c == nil || c.Status != metav1.ConditionFalse || c.Reason != "CRDNotInstalled" {
+		t.Errorf("RouteAccepted condition = %+v, want False because the CRD is not installed", c)
+	}
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	if err := r.Get(ctx, key, route); !errors.IsNotFound(err) {
+		t.Errorf("HTTPRoute created without the Gateway API, error = %v", err)
+	}
+}
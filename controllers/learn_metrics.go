@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Reconcile phases used as the "phase" label of the reconcile error counter
+const (
+	phaseCreate   = "create"
+	phaseManage   = "manage"
+	phaseStatus   = "status"
+	phaseFinalize = "finalize"
+	phasePlan     = "plan"
+)
+
+var (
+	driftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "learn_operator_drift_corrections_total",
+		Help: "Number of times an owned resource was updated back to the state defined by its Learn",
+	}, []string{"kind"})
+
+	rolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "learn_operator_rollout_duration_seconds",
+		Help:    "Time from a Deployment spec change until all its replicas are updated and available",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"namespace"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "learn_operator_reconcile_errors_total",
+		Help: "Number of failed Learn reconciles by phase",
+	}, []string{"phase"})
+
+	learnsDesc = prometheus.NewDesc(
+		"learn_operator_learns",
+		"Number of Learn objects by the status of their Ready condition",
+		[]string{"ready"}, nil)
+
+	desiredReplicasDesc = prometheus.NewDesc(
+		"learn_operator_learn_replicas_desired",
+		"Number of replicas the Learn Deployment currently wants, as set by the Learn or its autoscaler",
+		[]string{"namespace", "name"}, nil)
+
+	availableReplicasDesc = prometheus.NewDesc(
+		"learn_operator_learn_replicas_available",
+		"Number of available replicas of the Learn Deployment",
+		[]string{"namespace", "name"}, nil)
+
+	rollouts = &rolloutTracker{started: map[string]rolloutStart{}}
+)
+
+func init() {
+	metrics.Registry.MustRegister(driftCorrections, rolloutDuration, reconcileErrors)
+}
+
+// registerLearnCollector registers the collector reporting the Learn fleet read through reader
+func registerLearnCollector(reader client.Reader) error {
+	err := metrics.Registry.Register(&learnCollector{reader: reader})
+	if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return nil
+	}
+	return err
+}
+
+// learnCollector computes the Learn fleet metrics from the cache on every scrape
+type learnCollector struct {
+	reader client.Reader
+}
+
+// Describe implements prometheus.Collector
+func (c *learnCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- learnsDesc
+	ch <- desiredReplicasDesc
+	ch <- availableReplicasDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *learnCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	learns := &devopsv1alpha1.LearnList{}
+	if err := c.reader.List(ctx, learns); err != nil {
+		ch <- prometheus.NewInvalidMetric(learnsDesc, err)
+		return
+	}
+
+	byReady := map[metav1.ConditionStatus]float64{
+		metav1.ConditionTrue:    0,
+		metav1.ConditionFalse:   0,
+		metav1.ConditionUnknown: 0,
+	}
+	for i := range learns.Items {
+		learn := &learns.Items[i]
+		ready := metav1.ConditionUnknown
+		if cond := meta.FindStatusCondition(learn.Status.Conditions, devopsv1alpha1.ConditionReady); cond != nil {
+			ready = cond.Status
+		}
+		byReady[ready]++
+
+		// The replicas come from the Deployment rather than the Learn: an autoscaler
+		// owns spec.replicas of the Deployment and the Learn replicas are then ignored
+		dep := &appsv1.Deployment{}
+		err := c.reader.Get(ctx, types.NamespacedName{Name: learn.AppName(), Namespace: learn.Namespace}, dep)
+		if err != nil || !metav1.IsControlledBy(dep, learn) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desiredReplicasDesc, prometheus.GaugeValue,
+			float64(deploymentReplicas(dep)), learn.Namespace, learn.Name)
+		ch <- prometheus.MustNewConstMetric(availableReplicasDesc, prometheus.GaugeValue,
+			float64(dep.Status.AvailableReplicas), learn.Namespace, learn.Name)
+	}
+	for ready, count := range byReady {
+		ch <- prometheus.MustNewConstMetric(learnsDesc, prometheus.GaugeValue, count, string(ready))
+	}
+}
+
+type rolloutStart struct {
+	generation int64
+	at         time.Time
+}
+
+// rolloutTracker remembers when the operator first saw the Deployment of a
+// Learn rolling out, so the duration can be observed once the rollout
+// completes. The rollouts are keyed by the Learn, forgotten once it is gone.
+type rolloutTracker struct {
+	mu      sync.Mutex
+	started map[string]rolloutStart
+}
+
+// observe records the progress of the rollout of dep, the Deployment of learn
+func (t *rolloutTracker) observe(learn types.NamespacedName, dep *appsv1.Deployment) {
+	key := learn.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start, tracking := t.started[key]
+	if !rolloutComplete(dep) {
+		if !tracking || start.generation != dep.Generation {
+			t.started[key] = rolloutStart{generation: dep.Generation, at: time.Now()}
+		}
+		return
+	}
+	if tracking {
+		rolloutDuration.WithLabelValues(dep.Namespace).Observe(time.Since(start.at).Seconds())
+		delete(t.started, key)
+	}
+}
+
+// forget drops the rollout of the Deployment of learn, a deleted Learn
+// never completes it
+func (t *rolloutTracker) forget(learn types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.started, learn.String())
+}
+
+// rolloutComplete returns true when every replica of dep runs the latest template and is available
+func rolloutComplete(dep *appsv1.Deployment) bool {
+	replicas := deploymentReplicas(dep)
+	status := dep.Status
+	return status.ObservedGeneration >= dep.Generation &&
+		status.UpdatedReplicas == replicas &&
+		status.Replicas == replicas &&
+		status.AvailableReplicas == replicas
+}
+
+// deploymentReplicas returns spec.replicas of dep, 1 when the API server has not defaulted it yet
+func deploymentReplicas(dep *appsv1.Deployment) int32 {
+	if dep.Spec.Replicas == nil {
+		return 1
+	}
+	return *dep.Spec.Replicas
+}
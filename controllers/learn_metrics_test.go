@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// collectorLearn returns a Learn whose Ready condition has status ready
+func collectorLearn(name string, ready metav1.ConditionStatus) *devopsv1alpha1.Learn {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 2},
+	}
+	meta.SetStatusCondition(&learn.Status.Conditions, metav1.Condition{Type: devopsv1alpha1.ConditionReady, Status: ready, Reason: "Test"})
+	return learn
+}
+
+// collectorDeployment returns the Deployment of the app named name, controlled by owner when it is set
+func collectorDeployment(name string, owner *devopsv1alpha1.Learn, replicas, available int32) *appsv1.Deployment {
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: available},
+	}
+	if owner != nil {
+		dep.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, devopsv1alpha1.GroupVersion.WithKind("Learn"))}
+	}
+	return dep
+}
+
+func TestLearnCollector(t *testing.T) {
+	// The autoscaler scaled the Deployment of autoscaled down to 1, below the
+	// replicas of the Learn, and scaled the one of busy up to 5
+	autoscaled := collectorLearn("autoscaled", metav1.ConditionTrue)
+	busy := collectorLearn("busy", metav1.ConditionFalse)
+	pending := collectorLearn("pending", metav1.ConditionUnknown)
+	foreign := collectorLearn("foreign", metav1.ConditionFalse)
+	objs := []client.Object{
+		autoscaled, busy, pending, foreign,
+		collectorDeployment("autoscaled", autoscaled, 1, 1),
+		collectorDeployment("busy", busy, 5, 3),
+		collectorDeployment("foreign", nil, 4, 4),
+	}
+	collector := &learnCollector{reader: newFakeReconciler(objs...).Client}
+
+	want := `
+# HELP learn_operator_learn_replicas_available Number of available replicas of the Learn Deployment
+# TYPE learn_operator_learn_replicas_available gauge
+learn_operator_learn_replicas_available{name="autoscaled",namespace="default"} 1
+learn_operator_learn_replicas_available{name="busy",namespace="default"} 3
+# HELP learn_operator_learn_replicas_desired Number of replicas the Learn Deployment currently wants, as set by the Learn or its autoscaler
+# TYPE learn_operator_learn_replicas_desired gauge
+learn_operator_learn_replicas_desired{name="autoscaled",namespace="default"} 1
+learn_operator_learn_replicas_desired{name="busy",namespace="default"} 5
+# HELP learn_operator_learns Number of Learn objects by the status of their Ready condition
+# TYPE learn_operator_learns gauge
+learn_operator_learns{ready="False"} 2
+learn_operator_learns{ready="True"} 1
+learn_operator_learns{ready="Unknown"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRolloutTracker(t *testing.T) {
+	tracker := &rolloutTracker{started: map[string]rolloutStart{}}
+	dep := collectorDeployment("learn-sample", nil, 2, 0)
+	dep.Generation = 1
+	learn := types.NamespacedName{Name: "learn-sample", Namespace: "default"}
+	key := learn.String()
+	observations := func() uint64 {
+		t.Helper()
+		m, err := rolloutDuration.GetMetricWithLabelValues("default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &dto.Metric{}
+		if err := m.(prometheus.Histogram).Write(h); err != nil {
+			t.Fatal(err)
+		}
+		return h.GetHistogram().GetSampleCount()
+	}
+	before := observations()
+
+	tracker.observe(learn, dep)
+	start, tracking := tracker.started[key]
+	if !tracking || start.generation != 1 {
+		t.Fatalf("started = %v, want the rollout of generation 1 tracked", tracker.started)
+	}
+
+	// A second observation of the same generation keeps the first start time
+	tracker.observe(learn, dep)
+	if tracker.started[key].at != start.at {
+		t.Errorf("start time moved from %v to %v while the same generation rolls out", start.at, tracker.started[key].at)
+	}
+
+	// A new generation restarts the clock
+	dep.Generation = 2
+	tracker.observe(learn, dep)
+	if tracker.started[key].generation != 2 {
+		t.Errorf("started = %v, want the rollout of generation 2 tracked", tracker.started)
+	}
+	if got := observations(); got != before {
+		t.Errorf("rollout durations observed = %d, want none before the rollout completes", got-before)
+	}
+
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	tracker.observe(learn, dep)
+	if _, tracking := tracker.started[key]; tracking {
+		t.Errorf("started = %v, want the completed rollout forgotten", tracker.started)
+	}
+	if got := observations(); got != before+1 {
+		t.Errorf("rollout durations observed = %d, want one once the rollout completes", got-before)
+	}
+
+	// A Deployment already rolled out when first seen is not observed
+	tracker.observe(learn, dep)
+	if got := observations(); got != before+1 {
+		t.Errorf("rollout durations observed = %d, want no observation without a tracked start", got-before)
+	}
+
+	// The rollout of a deleted Learn is forgotten
+	dep.Generation = 3
+	tracker.observe(learn, dep)
+	tracker.forget(learn)
+	if _, tracking := tracker.started[key]; tracking {
+		t.Errorf("started = %v, want the rollout of the deleted Learn forgotten", tracker.started)
+	}
+}
+
+func TestReconcileForgetsRolloutOfMissingLearn(t *testing.T) {
+	key := types.NamespacedName{Name: "deleted", Namespace: "default"}
+	dep := collectorDeployment("deleted", nil, 2, 0)
+	dep.Generation = 1
+	rollouts.observe(key, dep)
+
+	r := newFakeReconciler()
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	rollouts.mu.Lock()
+	defer rollouts.mu.Unlock()
+	if _, tracking := rollouts.started[key.String()]; tracking {
+		t.Errorf("rollout of the missing Learn %s still tracked", key)
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status appsv1.DeploymentStatus
+		want   bool
+	}{
+		{"complete", appsv1.DeploymentStatus{ObservedGeneration: 3, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}, true},
+		{"generation not observed", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}, false},
+		{"old replicas left", appsv1.DeploymentStatus{ObservedGeneration: 3, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}, false},
+		{"replicas unavailable", appsv1.DeploymentStatus{ObservedGeneration: 3, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dep := collectorDeployment("learn-sample", nil, 2, 0)
+			dep.Generation = 3
+			dep.Status = tt.status
+			if got := rolloutComplete(dep); got != tt.want {
+				t.Errorf("rolloutComplete() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+func TestPausedLearnOnlyUpdatesStatus(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "paused", Namespace: "default", Finalizers: []string{statusFinalizer},
+			Annotations: map[string]string{devopsv1alpha1.AnnotationPaused: "true"},
+		},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "paused", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("Deployment created for a paused Learn: %v", err)
+	}
+	got := getLearn(t, r, key)
+	condition := meta.FindStatusCondition(got.Status.Conditions, devopsv1alpha1.ConditionPaused)
+	if condition == nil || condition.Reason != "Paused" {
+		t.Errorf("Paused condition = %+v, want reason Paused", condition)
+	}
+}
+
+func TestApprovalHoldsSpecChanges(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "approval", Namespace: "default", Finalizers: []string{statusFinalizer},
+			Annotations: map[string]string{devopsv1alpha1.AnnotationRequiresApproval: "true"},
+		},
+		Spec: devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0"},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "approval", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("Deployment created before the spec was approved: %v", err)
+	}
+
+	got := getLearn(t, r, key)
+	condition := meta.FindStatusCondition(got.Status.Conditions, devopsv1alpha1.ConditionPaused)
+	if condition == nil || condition.Reason != "AwaitingApproval" {
+		t.Fatalf("Paused condition = %+v, want reason AwaitingApproval", condition)
+	}
+	if got.Status.SpecHash == "" || got.Status.SpecHash != got.SpecHash() {
+		t.Fatalf("status.specHash = %q, want %q", got.Status.SpecHash, got.SpecHash())
+	}
+
+	got.Annotations[devopsv1alpha1.AnnotationApprovedSpecHash] = got.Status.SpecHash
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); err != nil {
+		t.Errorf("Deployment not created once the spec was approved: %v", err)
+	}
+	if condition := meta.FindStatusCondition(getLearn(t, r, key).Status.Conditions, devopsv1alpha1.ConditionPaused); condition != nil {
+		t.Errorf("Paused condition = %+v after the approval, want none", condition)
+	}
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcileStep reconciles one resource of a Learn. The steps run in the order
+// they are registered, a step only runs once every step it depends on is ready.
+type reconcileStep struct {
+	// name of the step, also used as the name of its span
+	name string
+	// apiVersion and kind of the resource the step reconciles, steps depend on
+	// each other by kind
+	apiVersion string
+	kind       string
+	// resourceName returns the name of the resource the step reconciles
+	resourceName func(cr *devopsv1alpha1.Learn) string
+	// dependsOn lists the kinds that must be ready before the step runs
+	dependsOn []string
+	// enabled reports whether the Learn asks for the resource, nil means always
+	enabled func(cr *devopsv1alpha1.Learn) bool
+	// run reconciles the resource
+	run func(ctx context.Context, cr *devopsv1alpha1.Learn) error
+	// desired returns the resource as built for the Learn, used by Plan mode
+	desired func(cr *devopsv1alpha1.Learn) client.Object
+}
+
+// enabledFor reports whether cr asks for the resource of the step
+func (s reconcileStep) enabledFor(cr *devopsv1alpha1.Learn) bool {
+	return s.enabled == nil || s.enabled(cr)
+}
+
+// stepResult is the outcome of a step in a reconcile
+type stepResult struct {
+	apiVersion string
+	kind       string
+	name       string
+	state      devopsv1alpha1.ResourceState
+	err        error
+}
+
+// learnSteps returns the registry of the steps reconciling the resources of a Learn
+func (r *LearnReconciler) learnSteps() []reconcileStep {
+	byName := func(cr *devopsv1alpha1.Learn) string { return cr.AppName() }
+	return []reconcileStep{
+		{
+			name:         "createConfigMapsCR",
+			apiVersion:   "v1",
+			kind:         "ConfigMap",
+			resourceName: func(cr *devopsv1alpha1.Learn) string { return cr.AppPodOptions().ConfigMapName },
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createConfigMapsCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewConfigMapCR(cr, configMapData, r.Scheme)
+			},
+		},
+		{
+			name:         "createServiceAccountCR",
+			apiVersion:   "v1",
+			kind:         "ServiceAccount",
+			resourceName: func(cr *devopsv1alpha1.Learn) string { return cr.AppPodOptions().ServiceAccountName },
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createServiceAccountCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewServiceAccount(cr, r.Scheme)
+			},
+		},
+		{
+			name:         "createDeploymentCR",
+			apiVersion:   "apps/v1",
+			kind:         "Deployment",
+			resourceName: byName,
+			dependsOn:    []string{"ConfigMap", "ServiceAccount"},
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createDeploymentCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewDeploymentForCR(cr, r.Scheme)
+			},
+		},
+		{
+			name:         "createServiceCR",
+			apiVersion:   "v1",
+			kind:         "Service",
+			resourceName: byName,
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createServiceCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewService(cr, r.Scheme)
+			},
+		},
+		{
+			name:         "createHpaCR",
+			apiVersion:   "autoscaling/v2beta2",
+			kind:         "HorizontalPodAutoscaler",
+			resourceName: byName,
+			dependsOn:    []string{"Deployment"},
+			enabled:      func(cr *devopsv1alpha1.Learn) bool { return cr.AppAutoscaling() != nil },
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createHpaCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewHorizontalPodAutoscalerForCR(cr, r.Scheme)
+			},
+		},
+		{
+			name:         "createServiceMonitorCR",
+			apiVersion:   serviceMonitorGVK.GroupVersion().String(),
+			kind:         serviceMonitorGVK.Kind,
+			resourceName: byName,
+			dependsOn:    []string{"Service"},
+			enabled:      func(cr *devopsv1alpha1.Learn) bool { return monitoringEnabled(cr) },
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createServiceMonitorCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewServiceMonitor(cr, r.Scheme)
+			},
+		},
+		{
+			name:         "createHTTPRouteCR",
+			apiVersion:   httpRouteGVK.GroupVersion().String(),
+			kind:         httpRouteGVK.Kind,
+			resourceName: byName,
+			dependsOn:    []string{"Service"},
+			enabled:      func(cr *devopsv1alpha1.Learn) bool { return gatewayEnabled(cr) },
+			run: func(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+				return r.createHTTPRouteCR(ctx, cr)
+			},
+			desired: func(cr *devopsv1alpha1.Learn) client.Object {
+				return NewHTTPRoute(cr, r.Scheme)
+			},
+		},
+	}
+}
+
+// runSteps runs the steps in order. A failing step does not stop the ones that
+// do not depend on it, those that do are reported as Blocked.
+func (r *LearnReconciler) runSteps(ctx context.Context, cr *devopsv1alpha1.Learn, request reconcile.Request, steps []reconcileStep) []stepResult {
+	results := make([]stepResult, 0, len(steps))
+	states := map[string]devopsv1alpha1.ResourceState{}
+	for _, step := range steps {
+		result := stepResult{apiVersion: step.apiVersion, kind: step.kind, name: step.resourceName(cr), state: devopsv1alpha1.ResourceReady}
+		switch {
+		case !step.enabledFor(cr):
+			result.state = devopsv1alpha1.ResourceDisabled
+		case len(blockedBy(step, states)) > 0:
+			result.state = devopsv1alpha1.ResourceBlocked
+			result.err = fmt.Errorf("waiting for %s", strings.Join(blockedBy(step, states), ", "))
+		default:
+			run := step.run
+			if err := r.traceStep(ctx, request.NamespacedName, step.name, step.kind, func(ctx context.Context) error {
+				return run(ctx, cr)
+			}); err != nil {
+				result.state = devopsv1alpha1.ResourceFailed
+				result.err = err
+			}
+		}
+		states[step.kind] = result.state
+		results = append(results, result)
+	}
+	return results
+}
+
+// blockedBy returns the dependencies of step that are not ready
+func blockedBy(step reconcileStep, states map[string]devopsv1alpha1.ResourceState) []string {
+	var blocked []string
+	for _, kind := range step.dependsOn {
+		if states[kind] != devopsv1alpha1.ResourceReady {
+			blocked = append(blocked, kind)
+		}
+	}
+	return blocked
+}
+
+// stepsError returns the errors of the failed steps, nil when none failed
+func stepsError(results []stepResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.state != devopsv1alpha1.ResourceFailed {
+			continue
+		}
+		// A ResourceError already names its resource
+		var resourceErr *ResourceError
+		if goerrors.As(result.err, &resourceErr) {
+			errs = append(errs, result.err)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s %s: %w", result.kind, result.name, result.err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// updateResourcesStatus records the step results in status.resources and the
+// inventory in status.inventory. The transition time of a resource only moves
+// when its state or error changes.
+func (r *LearnReconciler) updateResourcesStatus(ctx context.Context, request reconcile.Request, results []stepResult, inventory []devopsv1alpha1.InventoryEntry) error {
+	cr := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, request.NamespacedName, cr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	resources := mergeResourceStatus(cr.Status.Resources, results, metav1.Now())
+	if equality.Semantic.DeepEqual(resources, cr.Status.Resources) && equality.Semantic.DeepEqual(inventory, cr.Status.Inventory) {
+		return nil
+	}
+	cr.Status.Resources = resources
+	cr.Status.Inventory = inventory
+	return r.Status().Update(ctx, cr)
+}
+
+// mergeResourceStatus returns the status of the resources after a reconcile
+// that produced results, keeping the transition times that did not change
+func mergeResourceStatus(previous []devopsv1alpha1.ResourceStatus, results []stepResult, now metav1.Time) []devopsv1alpha1.ResourceStatus {
+	resources := make([]devopsv1alpha1.ResourceStatus, 0, len(results))
+	for _, result := range results {
+		status := devopsv1alpha1.ResourceStatus{
+			Kind:           result.kind,
+			Name:           result.name,
+			State:          result.state,
+			LastTransition: now,
+		}
+		if result.err != nil {
+			status.LastError = result.err.Error()
+		}
+		for _, old := range previous {
+			if old.Kind == status.Kind && old.Name == status.Name && old.State == status.State && old.LastError == status.LastError {
+				status.LastTransition = old.LastTransition
+			}
+		}
+		resources = append(resources, status)
+	}
+	return resources
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+func TestLearnStepsDependOnEarlierSteps(t *testing.T) {
+	seen := map[string]bool{}
+	for _, step := range (&LearnReconciler{}).learnSteps() {
+		for _, kind := range step.dependsOn {
+			if !seen[kind] {
+				t.Errorf("step %s depends on %s, which is not registered before it", step.name, kind)
+			}
+		}
+		seen[step.kind] = true
+	}
+}
+
+func TestFailedStepDoesNotBlockIndependentSteps(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "pipeline", Namespace: "default", Finalizers: []string{statusFinalizer}},
+	}
+	r := newFakeReconciler(learn)
+	r.Client = &failingCreateClient{Client: r.Client, kind: &corev1.Service{}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "pipeline", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("Reconcile() succeeded, want the Service create error")
+	}
+
+	if err := r.Get(context.Background(), req.NamespacedName, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("HorizontalPodAutoscaler not created after the Service failed: %v", err)
+	}
+
+	got := &devopsv1alpha1.Learn{}
+	if err := r.Get(context.Background(), req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]devopsv1alpha1.ResourceState{}
+	for _, resource := range got.Status.Resources {
+		states[resource.Kind] = resource.State
+		if resource.State == devopsv1alpha1.ResourceFailed && resource.LastError == "" {
+			t.Errorf("%s failed without lastError", resource.Kind)
+		}
+	}
+	want := map[string]devopsv1alpha1.ResourceState{
+		"ConfigMap":               devopsv1alpha1.ResourceReady,
+		"ServiceAccount":          devopsv1alpha1.ResourceReady,
+		"Deployment":              devopsv1alpha1.ResourceReady,
+		"Service":                 devopsv1alpha1.ResourceFailed,
+		"HorizontalPodAutoscaler": devopsv1alpha1.ResourceReady,
+		"ServiceMonitor":          devopsv1alpha1.ResourceDisabled,
+	}
+	for kind, state := range want {
+		if states[kind] != state {
+			t.Errorf("status.resources %s = %q, want %q", kind, states[kind], state)
+		}
+	}
+}
+
+func TestRunStepsBlocksDependents(t *testing.T) {
+	r := newFakeReconciler()
+	cr := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "blocked"}}
+	name := func(cr *devopsv1alpha1.Learn) string { return cr.Name }
+	ran := false
+	results := r.runSteps(context.Background(), cr, ctrl.Request{}, []reconcileStep{
+		{name: "a", kind: "A", resourceName: name, run: func(context.Context, *devopsv1alpha1.Learn) error { return errors.New("boom") }},
+		{name: "b", kind: "B", resourceName: name, dependsOn: []string{"A"}, run: func(context.Context, *devopsv1alpha1.Learn) error { ran = true; return nil }},
+	})
+	if ran {
+		t.Error("step b ran although step a failed")
+	}
+	if results[1].state != devopsv1alpha1.ResourceBlocked {
+		t.Errorf("step b state = %q, want Blocked", results[1].state)
+	}
+	if err := stepsError(results); err == nil {
+		t.Error("stepsError() = nil, want the error of step a")
+	}
+}
+
+func TestMergeResourceStatusKeepsTransitionTime(t *testing.T) {
+	before := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	now := metav1.Now()
+	previous := []devopsv1alpha1.ResourceStatus{
+		{Kind: "Deployment", Name: "app", State: devopsv1alpha1.ResourceReady, LastTransition: before},
+		{Kind: "Service", Name: "app", State: devopsv1alpha1.ResourceReady, LastTransition: before},
+	}
+	merged := mergeResourceStatus(previous, []stepResult{
+		{kind: "Deployment", name: "app", state: devopsv1alpha1.ResourceReady},
+		{kind: "Service", name: "app", state: devopsv1alpha1.ResourceFailed, err: errors.New("boom")},
+	}, now)
+	if !merged[0].LastTransition.Equal(&before) {
+		t.Errorf("unchanged resource transition = %v, want %v", merged[0].LastTransition, before)
+	}
+	if !merged[1].LastTransition.Equal(&now) || merged[1].LastError != "boom" {
+		t.Errorf("changed resource = %+v, want a new transition and the error", merged[1])
+	}
+}
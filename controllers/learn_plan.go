@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// maxPlannedFields caps the fields listed for a planned update
+const maxPlannedFields = 10
+
+// PlanChanges returns the changes Apply would make to the resources of cr,
+// computed as in Plan mode with the defaults of the reconciler applied to a
+// copy of cr. Nothing is changed.
+func (r *LearnReconciler) PlanChanges(ctx context.Context, cr *devopsv1alpha1.Learn) ([]devopsv1alpha1.PlannedChange, error) {
+	cr = cr.DeepCopy()
+	setDefaults(cr, r.Defaults)
+	return r.planChanges(ctx, cr)
+}
+
+// planChanges computes the changes Apply would make to the resources of the
+// Learn without making them. Every write is sent as a server-side dry-run so
+// the API server validates it and fills in its defaults, the result is then
+// compared with the live resource.
+func (r *LearnReconciler) planChanges(ctx context.Context, cr *devopsv1alpha1.Learn) ([]devopsv1alpha1.PlannedChange, error) {
+	var changes []devopsv1alpha1.PlannedChange
+	desired := map[devopsv1alpha1.InventoryEntry]bool{}
+	for _, step := range r.learnSteps() {
+		if !step.enabledFor(cr) {
+			continue
+		}
+		installed, err := r.stepInstalled(step)
+		if err != nil {
+			return nil, err
+		}
+		if !installed {
+			continue
+		}
+		desired[devopsv1alpha1.InventoryEntry{APIVersion: step.apiVersion, Kind: step.kind, Name: step.resourceName(cr)}] = true
+
+		change, err := r.planResource(ctx, cr, step.kind, step.desired(cr))
+		if err != nil {
+			return nil, fmt.Errorf("planning %s %s: %w", step.kind, step.resourceName(cr), err)
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	for _, entry := range cr.Status.Inventory {
+		if desired[entry] || isPruneProtected(cr, entry) {
+			continue
+		}
+		obj, err := r.prunableResource(ctx, cr, entry)
+		if err != nil {
+			return nil, fmt.Errorf("planning %s %s: %w", entry.Kind, entry.Name, err)
+		}
+		if obj == nil {
+			continue
+		}
+		change := devopsv1alpha1.PlannedChange{Kind: entry.Kind, Name: entry.Name, Action: devopsv1alpha1.PlanDelete}
+		if err := r.Delete(ctx, obj, client.DryRunAll); err != nil && !errors.IsNotFound(err) {
+			change.Error = err.Error()
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// planResource returns the change Apply would make to bring the live resource
+// to obj, nil when there is none
+func (r *LearnReconciler) planResource(ctx context.Context, cr *devopsv1alpha1.Learn, kind string, obj client.Object) (*devopsv1alpha1.PlannedChange, error) {
+	change := &devopsv1alpha1.PlannedChange{Kind: kind, Name: obj.GetName()}
+
+	live := obj.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if errors.IsNotFound(err) {
+		change.Action = devopsv1alpha1.PlanCreate
+		setOwnedByLabel(cr, obj)
+		if err := r.Create(ctx, obj, client.DryRunAll); err != nil {
+			change.Error = err.Error()
+		}
+		return change, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change.Action = devopsv1alpha1.PlanUpdate
+	applied := appliedState(cr, obj, live)
+	if !recreated(obj, live) {
+		if err := r.Update(ctx, applied, client.DryRunAll); err != nil {
+			change.Error = err.Error()
+			return change, nil
+		}
+	}
+	fields, err := changedFields(applied, live)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	change.Fields = fields
+	return change, nil
+}
+
+// stepInstalled reports whether the cluster serves the kind of step, the
+// kinds of the optional CRDs may be missing
+func (r *LearnReconciler) stepInstalled(step reconcileStep) (bool, error) {
+	switch step.kind {
+	case serviceMonitorGVK.Kind:
+		return r.serviceMonitorInstalled()
+	case httpRouteGVK.Kind:
+		return r.GatewayAPI, nil
+	}
+	return true, nil
+}
+
+// appliedState returns a copy of live with the changes Apply makes to it: the
+// labels and annotations of desired are merged in and only the fields the
+// ensure functions converge are taken from desired. The image and, without an
+// autoscaler, the replicas of a Deployment, the bounds of a
+// HorizontalPodAutoscaler, the owned fields of a Service and the spec of an
+// unstructured resource. Apply leaves the rest of the live resource alone, so
+// does the plan.
+func appliedState(cr *devopsv1alpha1.Learn, desired client.Object, live client.Object) client.Object {
+	applied := live.DeepCopyObject().(client.Object)
+	mergeMetadata(applied, desired)
+	switch obj := applied.(type) {
+	case *appsv1.Deployment:
+		mergeMetadata(&obj.Spec.Template, &desired.(*appsv1.Deployment).Spec.Template)
+		setAppImage(cr, obj)
+		if cr.AppAutoscaling() == nil {
+			setDepSize(cr, obj)
+		}
+	case *autoscalingv2beta2.HorizontalPodAutoscaler:
+		setHpaBounds(cr, obj)
+	case *corev1.Service:
+		want := desired.(*corev1.Service)
+		keepAllocatedServiceFields(want, obj)
+		setServiceSpec(obj, want)
+		if recreated(want, live) {
+			obj.Spec.ClusterIP = want.Spec.ClusterIP
+			obj.Spec.ClusterIPs = want.Spec.ClusterIPs
+		}
+	case *unstructured.Unstructured:
+		obj.Object["spec"] = desired.(*unstructured.Unstructured).Object["spec"]
+	}
+	return applied
+}
+
+// recreated reports whether Apply deletes and creates live again rather than
+// updating it, a Service switching to or from Headless. The API server would
+// refuse the dry-run of such an update.
+func recreated(desired client.Object, live client.Object) bool {
+	svc, ok := desired.(*corev1.Service)
+	return ok && isHeadless(svc) != isHeadless(live.(*corev1.Service))
+}
+
+// changedFields returns the sorted paths of the leaves that differ between the
+// desired and the live resource. Only the labels and annotations the builders
+// set are compared, what other controllers add to them is left out.
+func changedFields(desired client.Object, live client.Object) ([]string, error) {
+	want, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, err
+	}
+	have, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if !containsAll(live.GetLabels(), desired.GetLabels()) {
+		fields = append(fields, "metadata.labels")
+	}
+	if !containsAll(live.GetAnnotations(), desired.GetAnnotations()) {
+		fields = append(fields, "metadata.annotations")
+	}
+	for key, value := range want {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		fields = appendChangedFields(fields, key, value, have[key])
+	}
+	sort.Strings(fields)
+	if len(fields) > maxPlannedFields {
+		fields = append(fields[:maxPlannedFields], fmt.Sprintf("and %d more", len(fields)-maxPlannedFields))
+	}
+	return fields, nil
+}
+
+// containsAll reports whether have holds every entry of want
+func containsAll(have, want map[string]string) bool {
+	for k, v := range want {
+		if value, ok := have[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// appendChangedFields appends to fields the paths under path where want and
+// have differ, maps are walked and any other value is compared as a whole
+func appendChangedFields(fields []string, path string, want, have interface{}) []string {
+	wantMap, wantIsMap := want.(map[string]interface{})
+	haveMap, haveIsMap := have.(map[string]interface{})
+	if !wantIsMap || !haveIsMap {
+		if !reflect.DeepEqual(want, have) {
+			fields = append(fields, path)
+		}
+		return fields
+	}
+	for key := range wantMap {
+		fields = appendChangedFields(fields, path+"."+key, wantMap[key], haveMap[key])
+	}
+	for key := range haveMap {
+		if _, ok := wantMap[key]; !ok {
+			fields = append(fields, path+"."+key)
+		}
+	}
+	return fields
+}
+
+// updatePlannedChanges records the plan in status.plannedChanges
+func (r *LearnReconciler) updatePlannedChanges(ctx context.Context, request reconcile.Request, changes []devopsv1alpha1.PlannedChange) error {
+	cr := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, request.NamespacedName, cr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if equality.Semantic.DeepEqual(changes, cr.Status.PlannedChanges) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Planned changes of the Learn", "changes", len(changes))
+	cr.Status.PlannedChanges = changes
+	return r.Status().Update(ctx, cr)
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// setReconcileMode switches the Learn of key to mode and reconciles it
+func setReconcileMode(t *testing.T, r *LearnReconciler, key types.NamespacedName, mode devopsv1alpha1.ReconcileMode, mutate func(*devopsv1alpha1.Learn)) *devopsv1alpha1.Learn {
+	t.Helper()
+	learn := getLearn(t, r, key)
+	learn.Spec.ReconcileMode = mode
+	if mutate != nil {
+		mutate(learn)
+	}
+	if err := r.Update(context.Background(), learn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	return getLearn(t, r, key)
+}
+
+func TestPlanModeChangesNothing(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "plan", Namespace: "default", Finalizers: []string{statusFinalizer}},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", ReconcileMode: devopsv1alpha1.ReconcilePlan},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "plan", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("Deployment created in Plan mode: %v", err)
+	}
+
+	got := getLearn(t, r, key)
+	planned := map[string]devopsv1alpha1.PlanAction{}
+	for _, change := range got.Status.PlannedChanges {
+		planned[change.Kind] = change.Action
+	}
+	for _, kind := range []string{"ConfigMap", "ServiceAccount", "Deployment", "Service"} {
+		if planned[kind] != devopsv1alpha1.PlanCreate {
+			t.Errorf("planned action for %s = %q, want Create", kind, planned[kind])
+		}
+	}
+
+	got = setReconcileMode(t, r, key, devopsv1alpha1.ReconcileApply, nil)
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); err != nil {
+		t.Errorf("Deployment not created in Apply mode: %v", err)
+	}
+	if got.Status.PlannedChanges != nil {
+		t.Errorf("status.plannedChanges = %+v in Apply mode, want none", got.Status.PlannedChanges)
+	}
+}
+
+func TestPlanModeListsChangedFields(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "plan", Namespace: "default", Finalizers: []string{statusFinalizer}},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0"},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "plan", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got := setReconcileMode(t, r, key, devopsv1alpha1.ReconcilePlan, func(learn *devopsv1alpha1.Learn) {
+		learn.Spec.Image = "dxas90/learn:2.0.0"
+	})
+	if len(got.Status.PlannedChanges) != 5 {
+		t.Fatalf("status.plannedChanges = %+v, want an Update of the 5 resources", got.Status.PlannedChanges)
+	}
+	// The image tag is the app.kubernetes.io/version label of every resource
+	for _, change := range got.Status.PlannedChanges {
+		want := []string{"metadata.labels"}
+		if change.Kind == "Deployment" {
+			want = append(want, "spec.template.spec.containers")
+		}
+		if change.Action != devopsv1alpha1.PlanUpdate || strings.Join(change.Fields, ",") != strings.Join(want, ",") {
+			t.Errorf("planned change = %+v, want an Update of %v", change, want)
+		}
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if image := dep.Spec.Template.Spec.Containers[0].Image; image != "dxas90/learn:1.0.0" {
+		t.Errorf("Deployment image = %q in Plan mode, want it unchanged", image)
+	}
+}
+
+func TestPlanIgnoresFieldsApplyLeavesAlone(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "plan", Namespace: "default", Finalizers: []string{statusFinalizer}},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0"},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "plan", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// What users and other tools change on the resources, Apply keeps all of it
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	dep.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2021-06-01T00:00:00Z"}
+	app := &dep.Spec.Template.Spec.Containers[0]
+	app.Env = append(app.Env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+	app.ReadinessProbe = &corev1.Probe{Handler: corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"true"}}}}
+	if err := r.Update(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "plan-conf", Namespace: "default"}, cm); err != nil {
+		t.Fatal(err)
+	}
+	cm.Data = map[string]string{"extra": "value"}
+	if err := r.Update(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+
+	got := setReconcileMode(t, r, key, devopsv1alpha1.ReconcilePlan, nil)
+	if len(got.Status.PlannedChanges) != 0 {
+		t.Errorf("status.plannedChanges = %+v, want none for the fields Apply leaves alone", got.Status.PlannedChanges)
+	}
+
+	// Apply indeed leaves them alone
+	setReconcileMode(t, r, key, devopsv1alpha1.ReconcileApply, nil)
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if len(dep.Spec.Template.Spec.Containers[0].Env) == 0 || dep.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] == "" {
+		t.Errorf("Deployment template = %+v, want the changes of the user kept by Apply", dep.Spec.Template)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cm), cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["extra"] != "value" {
+		t.Errorf("ConfigMap data = %v, want the changes of the user kept by Apply", cm.Data)
+	}
+
+	// A change Apply makes is listed alone
+	got = setReconcileMode(t, r, key, devopsv1alpha1.ReconcilePlan, func(learn *devopsv1alpha1.Learn) {
+		learn.Spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{MinReplicas: 2, MaxReplicas: 4}
+	})
+	if len(got.Status.PlannedChanges) != 1 {
+		t.Fatalf("status.plannedChanges = %+v, want an Update of the HorizontalPodAutoscaler", got.Status.PlannedChanges)
+	}
+	if change := got.Status.PlannedChanges[0]; change.Kind != "HorizontalPodAutoscaler" || strings.Join(change.Fields, ",") != "spec.maxReplicas,spec.minReplicas" {
+		t.Errorf("planned change = %+v, want an Update of the autoscaler bounds", change)
+	}
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// pruneResources deletes the resources of the inventory the Learn no longer
+// asks for and returns the new inventory. A resource is only deleted when the
+// Learn controls it and spec.pruneProtection does not list it, protected
+// resources stay in the inventory so they are pruned once the protection is
+// lifted.
+func (r *LearnReconciler) pruneResources(ctx context.Context, cr *devopsv1alpha1.Learn, results []stepResult) ([]devopsv1alpha1.InventoryEntry, error) {
+	reqLogger := log.FromContext(ctx)
+
+	var inventory []devopsv1alpha1.InventoryEntry
+	desired := map[devopsv1alpha1.InventoryEntry]bool{}
+	for _, result := range results {
+		if result.state == devopsv1alpha1.ResourceDisabled {
+			continue
+		}
+		entry := devopsv1alpha1.InventoryEntry{APIVersion: result.apiVersion, Kind: result.kind, Name: result.name}
+		desired[entry] = true
+		if result.state == devopsv1alpha1.ResourceReady {
+			inventory = append(inventory, entry)
+		}
+	}
+
+	var errs []error
+	for _, entry := range cr.Status.Inventory {
+		if desired[entry] {
+			// A desired resource that failed this time stays in the inventory
+			if !containsEntry(inventory, entry) {
+				inventory = append(inventory, entry)
+			}
+			continue
+		}
+		if isPruneProtected(cr, entry) {
+			reqLogger.Info("Keeping prune protected resource", "kind", entry.Kind, "name", entry.Name)
+			inventory = append(inventory, entry)
+			continue
+		}
+		if err := r.pruneResource(ctx, cr, entry); err != nil {
+			errs = append(errs, fmt.Errorf("pruning %s %s: %w", entry.Kind, entry.Name, err))
+			inventory = append(inventory, entry)
+		}
+	}
+	return inventory, utilerrors.NewAggregate(errs)
+}
+
+// pruneResource deletes the resource of entry if the Learn owns it
+func (r *LearnReconciler) pruneResource(ctx context.Context, cr *devopsv1alpha1.Learn, entry devopsv1alpha1.InventoryEntry) error {
+	obj, err := r.prunableResource(ctx, cr, entry)
+	if err != nil || obj == nil {
+		return err
+	}
+	return r.deleteOwned(ctx, cr, obj)
+}
+
+// prunableResource returns the resource of entry when it exists and the Learn
+// controls it, nil otherwise. The controller reference is the proof of
+// ownership rather than the ownership label, which the resources created by
+// older versions of the operator do not carry.
+func (r *LearnReconciler) prunableResource(ctx context.Context, cr *devopsv1alpha1.Learn, entry devopsv1alpha1.InventoryEntry) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(entry.APIVersion, entry.Kind))
+	err := r.Get(ctx, client.ObjectKey{Name: entry.Name, Namespace: cr.Namespace}, obj)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// Already gone, or its API was removed with it
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !metav1.IsControlledBy(obj, cr) {
+		// Not controlled by this Learn, forget it without deleting it
+		return nil, nil
+	}
+	return obj, nil
+}
+
+// isPruneProtected reports whether spec.pruneProtection lists the resource of entry
+func isPruneProtected(cr *devopsv1alpha1.Learn, entry devopsv1alpha1.InventoryEntry) bool {
+	for _, ref := range cr.Spec.PruneProtection {
+		if ref.Kind == entry.Kind && (ref.Name == "" || ref.Name == entry.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsEntry reports whether inventory holds entry
+func containsEntry(inventory []devopsv1alpha1.InventoryEntry, entry devopsv1alpha1.InventoryEntry) bool {
+	for _, e := range inventory {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
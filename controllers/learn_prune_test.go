@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// disableAutoscaling reconciles the Learn once, turns its autoscaler off,
+// applies mutate and reconciles it again
+func disableAutoscaling(t *testing.T, mutate func(*devopsv1alpha1.Learn)) (*LearnReconciler, types.NamespacedName) {
+	t.Helper()
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "prune", Namespace: "default", UID: "prune-uid", Finalizers: []string{statusFinalizer}},
+	}
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "prune", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("first Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err != nil {
+		t.Fatalf("HorizontalPodAutoscaler not created: %v", err)
+	}
+
+	if err := r.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	learn.Spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{Enabled: &disabled}
+	if mutate != nil {
+		mutate(learn)
+	}
+	if err := r.Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+	return r, key
+}
+
+func TestPruneDisabledAutoscaler(t *testing.T) {
+	r, key := disableAutoscaling(t, nil)
+
+	err := r.Get(context.Background(), key, &autoscalingv2beta2.HorizontalPodAutoscaler{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("HorizontalPodAutoscaler not pruned, Get() error = %v", err)
+	}
+	learn := &devopsv1alpha1.Learn{}
+	if err := r.Get(context.Background(), key, learn); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range learn.Status.Inventory {
+		if entry.Kind == "HorizontalPodAutoscaler" {
+			t.Errorf("pruned HorizontalPodAutoscaler still in the inventory: %v", learn.Status.Inventory)
+		}
+	}
+	if len(learn.Status.Inventory) != 4 {
+		t.Errorf("inventory = %v, want the ConfigMap, ServiceAccount, Deployment and Service", learn.Status.Inventory)
+	}
+}
+
+func TestPruneProtection(t *testing.T) {
+	r, key := disableAutoscaling(t, func(learn *devopsv1alpha1.Learn) {
+		learn.Spec.PruneProtection = []devopsv1alpha1.ResourceRef{{Kind: "HorizontalPodAutoscaler"}}
+	})
+	if err := r.Get(context.Background(), key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("protected HorizontalPodAutoscaler pruned: %v", err)
+	}
+}
+
+func TestPruneSkipsResourcesNotControlled(t *testing.T) {
+	r, key := disableAutoscaling(t, func(learn *devopsv1alpha1.Learn) {
+		learn.Spec.PruneProtection = []devopsv1alpha1.ResourceRef{{Kind: "HorizontalPodAutoscaler", Name: "prune"}}
+	})
+	ctx := context.Background()
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	if err := r.Get(ctx, key, hpa); err != nil {
+		t.Fatal(err)
+	}
+	// Someone released the autoscaler, it still carries the ownership label
+	hpa.OwnerReferences = nil
+	if err := r.Update(ctx, hpa); err != nil {
+		t.Fatal(err)
+	}
+	learn := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	learn.Spec.PruneProtection = nil
+	if err := r.Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("HorizontalPodAutoscaler not controlled by the Learn pruned: %v", err)
+	}
+	if err := r.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range learn.Status.Inventory {
+		if entry.Kind == "HorizontalPodAutoscaler" {
+			t.Errorf("released HorizontalPodAutoscaler still in the inventory: %v", learn.Status.Inventory)
+		}
+	}
+}
+
+func TestPruneResourcesCreatedBeforeOwnershipLabel(t *testing.T) {
+	// An older operator created the autoscaler, controlled by the Learn but
+	// without the ownership label
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "prune", Namespace: "default", UID: "prune-uid", Finalizers: []string{statusFinalizer}},
+	}
+	s := newFakeReconciler().Scheme
+	hpa := NewHorizontalPodAutoscalerForCR(learn, s)
+	delete(hpa.Labels, devopsv1alpha1.LabelOwnedBy)
+	r := newFakeReconciler(learn, hpa)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "prune", Namespace: "default"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("first Reconcile() error = %v", err)
+	}
+
+	if err := r.Get(ctx, key, learn); err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	learn.Spec.Autoscaling = &devopsv1alpha1.AutoscalingSpec{Enabled: &disabled}
+	learn.Spec.Replicas = 4
+	if err := r.Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); !errors.IsNotFound(err) {
+		t.Errorf("HorizontalPodAutoscaler without the ownership label not pruned, Get() error = %v", err)
+	}
+
+	// Without the autoscaler the replicas of the Learn are enforced again
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("third Reconcile() error = %v", err)
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		t.Fatal(err)
+	}
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != 4 {
+		t.Errorf("Deployment replicas = %v, want the 4 of the Learn once the autoscaler is pruned", dep.Spec.Replicas)
+	}
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RenderLearn returns the resources the operator creates for cr, in the order
+// it creates them: the desired resource of every step of the reconcile that
+// cr enables. The operator defaults are applied to a copy of cr first, as
+// Reconcile does, so the result matches what runs in the cluster.
+func RenderLearn(cr *devopsv1alpha1.Learn, defaults configv1alpha1.LearnDefaults, scheme *runtime.Scheme) []client.Object {
+	cr = cr.DeepCopy()
+	setDefaults(cr, defaults)
+	var resources []client.Object
+	for _, step := range (&LearnReconciler{Scheme: scheme}).learnSteps() {
+		if step.enabledFor(cr) {
+			resources = append(resources, step.desired(cr))
+		}
+	}
+	return resources
+}
@@ -4,20 +4,21 @@ import (
 	"context"
 
 	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
-	appsv1 "k8s.io/api/apps/v1"
-	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var (
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	httpRouteGVK      = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
 	configMapData    = make(map[string]string)
 	envConfigMapData = make(map[string]string)
 )
@@ -33,448 +34,150 @@ func init() {
 	}
 }
 
-func (r *LearnReconciler) createResources(ctx context.Context, cr *devopsv1alpha1.Learn, request reconcile.Request) error {
+// createResources runs the reconcile steps of the Learn, prunes the resources
+// it no longer asks for and records the outcome in status.resources and
+// status.inventory. It returns the step results, with the errors of the failed
+// steps and of the pruning.
+func (r *LearnReconciler) createResources(ctx context.Context, cr *devopsv1alpha1.Learn, request reconcile.Request) ([]stepResult, error) {
 	reqLogger := log.FromContext(ctx)
-	reqLogger.Info("Creating Status resources ...")
+	reqLogger.Info("Creating Learn resources ...")
 
-	// Check if service for the app exist, if not create one
-	if err := r.createConfigMapsCR(cr); err != nil {
-		reqLogger.Error(err, "Failed to create ConfigMaps")
-		return err
+	results := r.runSteps(ctx, cr, request, r.learnSteps())
+	for _, result := range results {
+		if result.state == devopsv1alpha1.ResourceFailed {
+			reqLogger.Error(result.err, "Failed to reconcile "+result.kind, "name", result.name)
+		}
 	}
-
-	// Check if ServiceAccount for the app exist, if not create one
-	if err := r.createServiceAccountCR(cr); err != nil {
-		reqLogger.Error(err, "Failed to create ServiceAccount")
-		return err
+	inventory, pruneErr := r.pruneResources(ctx, cr, results)
+	if pruneErr != nil {
+		reqLogger.Error(pruneErr, "Failed to prune the resources the Learn no longer asks for")
 	}
-
-	// Check if Deployment for the app exist, if not create one
-	if err := r.createDeploymentCR(cr); err != nil {
-		reqLogger.Error(err, "Failed to create Deployment")
-		return err
+	if err := r.updateResourcesStatus(ctx, request, results, inventory); err != nil {
+		return results, err
 	}
-
-	// Check if createServiceCR for the app exist, if not create one
-	if err := r.createServiceCR(cr); err != nil {
-		reqLogger.Error(err, "Failed to create Service")
-		return err
-	}
-
-	// Check if HPA for the app exist, if not create one
-	if err := r.createHpaCR(cr); err != nil {
-		reqLogger.Error(err, "Failed to create HorizontalPodAutoscaler")
-		return err
-	}
-
-	return nil
+	return results, utilerrors.NewAggregate([]error{stepsError(results), pruneErr})
 }
 
 // Check if Service for the app exist, if not create one
-func (r *LearnReconciler) createServiceCR(cr *devopsv1alpha1.Learn) error {
-	ctx := context.Background()
-	srv := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, srv)
-	if err != nil {
-		if err := r.Create(ctx, NewService(cr, r.Scheme)); err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *LearnReconciler) createServiceCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	return r.owned().ensureCreated(ctx, cr, NewService(cr, r.Scheme))
 }
 
 // Check if ConfigMap for the app exist, if not create one
-func (r *LearnReconciler) createConfigMapsCR(cr *devopsv1alpha1.Learn) error {
-	ctx := context.Background()
-	cm := &corev1.ConfigMap{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name + "-conf",
-		Namespace: cr.Namespace,
-	}, cm)
-	if err != nil {
-		if err := r.Create(ctx, NewConfigMapCR(cr, "-conf", configMapData, r.Scheme)); err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *LearnReconciler) createConfigMapsCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	return r.owned().ensureCreated(ctx, cr, NewConfigMapCR(cr, configMapData, r.Scheme))
 }
 
 // Check if ServiceAccount for the app exist, if not create one
-func (r *LearnReconciler) createServiceAccountCR(cr *devopsv1alpha1.Learn) error {
-	ctx := context.Background()
-	sa := &corev1.ServiceAccount{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name + "-sa",
-		Namespace: cr.Namespace,
-	}, sa)
-	if err != nil {
-		if err := r.Create(ctx, NewServiceAccount(cr, r.Scheme)); err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *LearnReconciler) createServiceAccountCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	return r.owned().ensureCreated(ctx, cr, NewServiceAccount(cr, r.Scheme))
 }
 
 // Check if Deployment for the app exist, if not create one
-func (r *LearnReconciler) createDeploymentCR(cr *devopsv1alpha1.Learn) error {
-	ctx := context.Background()
-	deployment := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, deployment)
-	if err != nil {
-		if err := r.Create(ctx, NewDeploymentForCR(cr, r.Scheme)); err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *LearnReconciler) createDeploymentCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	return r.owned().ensureCreated(ctx, cr, NewDeploymentForCR(cr, r.Scheme))
 }
 
 // Check if HPA for the app exist, if not create one
-func (r *LearnReconciler) createHpaCR(cr *devopsv1alpha1.Learn) error {
-	ctx := context.Background()
-	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, hpa)
-	if err != nil {
-		if err := r.Create(ctx, NewHorizontalPodAutoscalerForCR(cr, r.Scheme)); err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *LearnReconciler) createHpaCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	return r.owned().ensureCreated(ctx, cr, NewHorizontalPodAutoscalerForCR(cr, r.Scheme))
 }
 
-// newPodForCR returns a configMap with the value of Data the cr
-func NewConfigMapCR(cr *devopsv1alpha1.Learn, suffix string, Data map[string]string, scheme *runtime.Scheme) *corev1.ConfigMap {
-	labels := map[string]string{
-		"app":    cr.Name,
-		"devops": cr.Name,
+// Check if ServiceMonitor for the app exist, if not create one. Nothing is
+// done when monitoring is disabled or the Prometheus Operator is not installed,
+// the ServiceMonitorReady condition reports the latter.
+func (r *LearnReconciler) createServiceMonitorCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	if !monitoringEnabled(cr) {
+		return nil
 	}
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name + suffix,
-			Namespace: cr.Namespace,
-			Labels:    labels,
-		},
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "ConfigMap",
-			APIVersion: "v1",
-		},
-		Data: Data,
+	installed, err := r.serviceMonitorInstalled()
+	if err != nil || !installed {
+		return err
 	}
-	controllerutil.SetControllerReference(cr, configMap, scheme)
-	return configMap
+
+	return r.ensureUnstructured(ctx, cr, NewServiceMonitor(cr, r.Scheme))
 }
 
-// Returns the service object for the Learn app
-func NewService(cr *devopsv1alpha1.Learn, scheme *runtime.Scheme) *corev1.Service {
-	labels := map[string]string{
-		"app":    cr.Name,
-		"devops": cr.Name,
+// Check if HTTPRoute for the app exist, if not create one. Nothing is done
+// when the app has no gateway or the Gateway API was not installed when the
+// operator started, the RouteAccepted condition reports the latter.
+func (r *LearnReconciler) createHTTPRouteCR(ctx context.Context, cr *devopsv1alpha1.Learn) error {
+	if !gatewayEnabled(cr) || !r.GatewayAPI {
+		return nil
 	}
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name,
-			Namespace: cr.Namespace,
-			Labels:    labels,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: labels,
-			Type:     corev1.ServiceTypeClusterIP,
-			Ports: []corev1.ServicePort{
-				{
-					Name: "web",
-					TargetPort: intstr.IntOrString{
-						Type:   intstr.Int,
-						IntVal: 8080,
-					},
-					Port:     8080,
-					Protocol: "TCP",
-				},
-			},
-		},
-	}
-	// Set Status cr as the owner and controller
-	controllerutil.SetControllerReference(cr, service, scheme)
-	return service
+	return r.ensureUnstructured(ctx, cr, NewHTTPRoute(cr, r.Scheme))
 }
 
-// NewDeploymentForCR returns a deployment name/namespace as the cr
-func NewDeploymentForCR(cr *devopsv1alpha1.Learn, scheme *runtime.Scheme) *appsv1.Deployment {
-	labels := map[string]string{
-		"app":    cr.Name,
-		"devops": cr.Name,
+// ensureUnstructured creates desired, a resource of a CRD the operator has no
+// types for, when it does not exist yet. An existing one is adopted as the
+// policy of cr allows and its spec is brought back to the desired one.
+func (r *LearnReconciler) ensureUnstructured(ctx context.Context, cr *devopsv1alpha1.Learn, desired *unstructured.Unstructured) error {
+	kind := desired.GetKind()
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(desired.GroupVersionKind())
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      desired.GetName(),
+		Namespace: desired.GetNamespace(),
+	}, live)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.createOwned(ctx, cr, desired)
+		}
+		return resourceError("get", kind, desired.GetName(), err)
 	}
-	var defaultMode int32 = 0755
-	var defaultFSGroup int64 = 65534
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: cr.Namespace,
-			Name:      cr.Name,
-			Labels:    labels,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Replicas: &cr.Spec.Replicas,
-			Strategy: appsv1.DeploymentStrategy{
-				RollingUpdate: &appsv1.RollingUpdateDeployment{
-					MaxUnavailable: &intstr.IntOrString{
-						Type:   intstr.Int,
-						IntVal: 0,
-					},
-					MaxSurge: &intstr.IntOrString{
-						Type:   intstr.Int,
-						IntVal: 2,
-					},
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: cr.Name + "-conf",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: cr.Name + "-conf",
-									},
-									DefaultMode: &defaultMode,
-								},
-							},
-						},
-					},
-					InitContainers: []corev1.Container{
-						{
-							Name:            "pull-secrets",
-							Image:           "busybox",
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							EnvFrom: []corev1.EnvFromSource{
-								{
-									ConfigMapRef: &corev1.ConfigMapEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: cr.Name + "-conf",
-										},
-									},
-								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name: "POD_IP",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "status.podIP",
-										},
-									},
-								},
-								{
-									Name: "POD_NAMESPACE",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "metadata.namespace",
-										},
-									},
-								},
-							},
-							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("5m"),
-									corev1.ResourceMemory: resource.MustParse("16Mi"),
-								},
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("5m"),
-									corev1.ResourceMemory: resource.MustParse("16Mi"),
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						{
-							Name:            cr.Name,
-							Image:           cr.Spec.Image,
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "web",
-									ContainerPort: 8080,
-									Protocol:      "TCP",
-								},
-							},
-							EnvFrom: []corev1.EnvFromSource{
-								{
-									ConfigMapRef: &corev1.ConfigMapEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: cr.Name + "-conf",
-										},
-									},
-								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name: "POD_IP",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "status.podIP",
-										},
-									},
-								},
-								{
-									Name: "POD_NAME",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "metadata.name",
-										},
-									},
-								},
-								{
-									Name: "MY_NAMESPACE",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "metadata.namespace",
-										},
-									},
-								},
-								{
-									Name: "USER",
-									ValueFrom: &corev1.EnvVarSource{
-										FieldRef: &corev1.ObjectFieldSelector{
-											APIVersion: "v1",
-											FieldPath:  "metadata.name",
-										},
-									},
-								},
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      cr.Name + "-conf",
-									MountPath: "/conf",
-									ReadOnly:  true,
-								},
-							},
-							ReadinessProbe: &corev1.Probe{
-								Handler: corev1.Handler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/healthz",
-										Port: intstr.IntOrString{
-											Type:   intstr.String,
-											StrVal: "web",
-										},
-									},
-								},
-								InitialDelaySeconds: 3,
-								TimeoutSeconds:      2,
-								FailureThreshold:    5,
-							},
-							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("10m"),
-									corev1.ResourceMemory: resource.MustParse("48Mi"),
-								},
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("10m"),
-									corev1.ResourceMemory: resource.MustParse("48Mi"),
-								},
-							},
-							TerminationMessagePath:   "/dev/termination-log",
-							TerminationMessagePolicy: "File",
-						},
-					},
-					DNSPolicy:     corev1.DNSClusterFirst,
-					RestartPolicy: corev1.RestartPolicyAlways,
-					SecurityContext: &corev1.PodSecurityContext{
-						FSGroup: &defaultFSGroup,
-					},
-					ServiceAccountName: cr.Name + "-sa",
-				},
-			},
-		},
+	if err := r.owned().adopt(ctx, cr, live); err != nil {
+		return err
 	}
-	controllerutil.SetControllerReference(cr, deployment, scheme)
-	return deployment
-}
-
-// Returns the ServiceAccount object for the Learn app
-func NewServiceAccount(cr *devopsv1alpha1.Learn, scheme *runtime.Scheme) *corev1.ServiceAccount {
-	labels := map[string]string{
-		"app":    cr.Name,
-		"devops": cr.Name,
+	if err := r.owned().ensureMetadata(ctx, cr, live, desired); err != nil {
+		return err
 	}
-	serviceAccount := &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name + "-sa",
-			Namespace: cr.Namespace,
-			Labels:    labels,
-		},
+	if !equality.Semantic.DeepEqual(live.Object["spec"], desired.Object["spec"]) {
+		live.Object["spec"] = desired.Object["spec"]
+		if err := r.updateOwned(ctx, cr, live); err != nil {
+			return err
+		}
+		driftCorrections.WithLabelValues(kind).Inc()
 	}
-	// Set Status cr as the owner and controller
-	controllerutil.SetControllerReference(cr, serviceAccount, scheme)
-	return serviceAccount
+	return nil
+}
+
+// serviceMonitorInstalled returns true when the ServiceMonitor CRD is served by the cluster
+func (r *LearnReconciler) serviceMonitorInstalled() (bool, error) {
+	return kindServed(r.RESTMapper(), serviceMonitorGVK)
 }
 
-// Returns the ServiceAccount object for the Learn app
-func NewHorizontalPodAutoscalerForCR(cr *devopsv1alpha1.Learn, scheme *runtime.Scheme) *autoscalingv2beta2.HorizontalPodAutoscaler {
-	labels := map[string]string{
-		"app":    cr.Name,
-		"devops": cr.Name,
+// GatewayAPIInstalled returns true when the gateway.networking.k8s.io/v1
+// HTTPRoute CRD is served by the cluster. The manager checks it once at
+// startup, the HTTPRoutes can only be watched when it is.
+func GatewayAPIInstalled(mapper meta.RESTMapper) (bool, error) {
+	return kindServed(mapper, httpRouteGVK)
+}
+
+// ServedOptionalKinds returns the kinds of the optional CRDs the operator
+// creates resources of, the ServiceMonitor and the HTTPRoute, that are served
+// by the cluster
+func ServedOptionalKinds(mapper meta.RESTMapper) ([]schema.GroupVersionKind, error) {
+	var served []schema.GroupVersionKind
+	for _, gvk := range []schema.GroupVersionKind{serviceMonitorGVK, httpRouteGVK} {
+		ok, err := kindServed(mapper, gvk)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			served = append(served, gvk)
+		}
 	}
-	// TODO change from config
-	var MinReplicas int32 = 1
-	var MaxReplicas int32 = 5
-	var averageCPUUtilization int32 = 80
-	var averageMemoryValue int64 = 50
-	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name,
-			Namespace: cr.Namespace,
-			Labels:    labels,
-		}, Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
-			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
-				Kind:       "Deployment",
-				APIVersion: "apps/v1",
-				Name:       cr.Name,
-			},
-			MinReplicas: &MinReplicas,
-			MaxReplicas: MaxReplicas,
-			Metrics: []autoscalingv2beta2.MetricSpec{
-				{
-					Type: "Resource",
-					Resource: &autoscalingv2beta2.ResourceMetricSource{
-						Name: "cpu",
-						Target: autoscalingv2beta2.MetricTarget{
-							Type:               autoscalingv2beta2.UtilizationMetricType,
-							AverageUtilization: &averageCPUUtilization,
-						},
-					},
-				},
-				{
-					Type: "Resource",
-					Resource: &autoscalingv2beta2.ResourceMetricSource{
-						Name: "memory",
-						Target: autoscalingv2beta2.MetricTarget{
-							Type:         autoscalingv2beta2.AverageValueMetricType,
-							AverageValue: resource.NewQuantity(averageMemoryValue, resource.MustParse("Mi").Format),
-						},
-					},
-				},
-			},
-		},
+	return served, nil
+}
+
+// kindServed returns true when the kind of gvk is served by the cluster
+func kindServed(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
 	}
-	// Set Status cr as the owner and controller
-	controllerutil.SetControllerReference(cr, hpa, scheme)
-	return hpa
+	return true, nil
 }
@@ -8,11 +8,19 @@ import (
 	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
 
 	"reflect"
+	"sort"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -24,12 +32,16 @@ func (r *LearnReconciler) createUpdateCRStatus(ctx context.Context, request reco
 	reqLogger := log.FromContext(ctx)
 	reqLogger.Info("Create/Update Status status ...")
 
-	if err := r.updateDeploymentStatus(request); err != nil {
+	if err := r.traceStep(ctx, request.NamespacedName, "updateDeploymentStatus", "Deployment", func(ctx context.Context) error {
+		return r.updateDeploymentStatus(ctx, request)
+	}); err != nil {
 		reqLogger.Error(err, "Failed to create Deployment Status")
 		return err
 	}
 
-	if err := r.updateServiceStatus(request); err != nil {
+	if err := r.traceStep(ctx, request.NamespacedName, "updateServiceStatus", "Service", func(ctx context.Context) error {
+		return r.updateServiceStatus(ctx, request)
+	}); err != nil {
 		reqLogger.Error(err, "Failed to create Service Status")
 		return err
 	}
@@ -39,7 +51,9 @@ func (r *LearnReconciler) createUpdateCRStatus(ctx context.Context, request reco
 	// 	return err
 	// }
 
-	if err := r.updateStatus(request); err != nil {
+	if err := r.traceStep(ctx, request.NamespacedName, "updateStatus", "", func(ctx context.Context) error {
+		return r.updateStatus(ctx, request)
+	}); err != nil {
 		reqLogger.Error(err, "Failed to create Status")
 		return err
 	}
@@ -47,8 +61,7 @@ func (r *LearnReconciler) createUpdateCRStatus(ctx context.Context, request reco
 }
 
 //updateStatusStatus returns error when status regards the all required resource could not be updated
-func (r *LearnReconciler) updateStatus(request reconcile.Request) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) updateStatus(ctx context.Context, request reconcile.Request) error {
 	Status := &devopsv1alpha1.Learn{}
 	err := r.Get(ctx, types.NamespacedName{
 		Name:      request.Name,
@@ -60,22 +73,210 @@ func (r *LearnReconciler) updateStatus(request reconcile.Request) error {
 
 	statusMsgUpdate := statusOk
 	// Check if all required resource were created and found
-	if err := r.isAllCreated(Status); err != nil {
+	if err := r.isAllCreated(ctx, Status); err != nil {
 		statusMsgUpdate = err.Error()
 	}
 
+	monitoring, err := r.serviceMonitorCondition(ctx, Status)
+	if err != nil {
+		return err
+	}
+	route, err := r.routeCondition(ctx, Status)
+	if err != nil {
+		return err
+	}
+
 	// Check if BackupStatus was changed, if yes update it
-	if err := r.insertUpdateGeneralStatus(Status, statusMsgUpdate); err != nil {
+	optional := map[string]*metav1.Condition{
+		devopsv1alpha1.ConditionServiceMonitorReady: monitoring,
+		devopsv1alpha1.ConditionRouteAccepted:       route,
+	}
+	if err := r.insertUpdateGeneralStatus(ctx, Status, statusMsgUpdate, optional); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Check if General Status was changed, if yes update it
-func (r *LearnReconciler) insertUpdateGeneralStatus(cr *devopsv1alpha1.Learn, statusMsgUpdate string) error {
-	ctx := context.TODO()
-	if statusMsgUpdate != cr.Status.Status {
+// serviceMonitorCondition returns the ServiceMonitorReady condition, nil when monitoring is disabled
+func (r *LearnReconciler) serviceMonitorCondition(ctx context.Context, cr *devopsv1alpha1.Learn) (*metav1.Condition, error) {
+	if !monitoringEnabled(cr) {
+		return nil, nil
+	}
+	condition := &metav1.Condition{
+		Type:               devopsv1alpha1.ConditionServiceMonitorReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Created",
+		Message:            "ServiceMonitor " + cr.AppName() + " scrapes the app",
+		ObservedGeneration: cr.Generation,
+	}
+	installed, err := r.serviceMonitorInstalled()
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CRDNotInstalled"
+		condition.Message = "The monitoring.coreos.com/v1 ServiceMonitor CRD is not installed, install the Prometheus Operator to scrape the app"
+		return condition, nil
+	}
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	err = r.Get(ctx, types.NamespacedName{
+		Name:      cr.AppName(),
+		Namespace: cr.Namespace,
+	}, sm)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Missing"
+		condition.Message = "ServiceMonitor " + cr.AppName() + " has not been created yet"
+	}
+	return condition, nil
+}
+
+// routeCondition returns the RouteAccepted condition from the status the
+// Gateways wrote on the HTTPRoute, nil when the Learn has no gateway
+func (r *LearnReconciler) routeCondition(ctx context.Context, cr *devopsv1alpha1.Learn) (*metav1.Condition, error) {
+	if !gatewayEnabled(cr) {
+		return nil, nil
+	}
+	condition := &metav1.Condition{
+		Type:               devopsv1alpha1.ConditionRouteAccepted,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: cr.Generation,
+	}
+	if !r.GatewayAPI {
+		condition.Reason = "CRDNotInstalled"
+		condition.Message = "The gateway.networking.k8s.io/v1 HTTPRoute CRD was not installed when the operator started, install the Gateway API and restart the operator to route to the app"
+		return condition, nil
+	}
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      cr.AppName(),
+		Namespace: cr.Namespace,
+	}, route)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		condition.Reason = "Missing"
+		condition.Message = "HTTPRoute " + cr.AppName() + " has not been created yet"
+		return condition, nil
+	}
+
+	reason, message := RouteAcceptance(cr, route)
+	condition.Reason = reason
+	condition.Message = message
+	switch reason {
+	case "Accepted":
+		condition.Status = metav1.ConditionTrue
+	case "Pending":
+		condition.Status = metav1.ConditionUnknown
+	}
+	return condition, nil
+}
+
+// routeParentStatus is the part of the status a Gateway writes on an HTTPRoute the operator reads
+type routeParentStatus struct {
+	ParentRef struct {
+		Name        string `json:"name"`
+		Namespace   string `json:"namespace,omitempty"`
+		SectionName string `json:"sectionName,omitempty"`
+	} `json:"parentRef"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RouteAcceptance returns the reason and the message of the RouteAccepted
+// condition: Accepted when every Gateway of cr accepted route and resolved its
+// backends, Pending while one has not reported on it yet and the reason of the
+// first Accepted or ResolvedRefs condition that is not True otherwise
+func RouteAcceptance(cr *devopsv1alpha1.Learn, route *unstructured.Unstructured) (string, string) {
+	var status struct {
+		Parents []routeParentStatus `json:"parents,omitempty"`
+	}
+	if raw, ok := route.Object["status"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+			return "InvalidStatus", "The status of HTTPRoute " + route.GetName() + " cannot be read: " + err.Error()
+		}
+	}
+	parentName := func(namespace, name, sectionName string) string {
+		if namespace == "" {
+			namespace = cr.Namespace
+		}
+		if sectionName != "" {
+			return namespace + "/" + name + "/" + sectionName
+		}
+		return namespace + "/" + name
+	}
+	reported := map[string][]metav1.Condition{}
+	for _, parent := range status.Parents {
+		ref := parent.ParentRef
+		key := parentName(ref.Namespace, ref.Name, ref.SectionName)
+		reported[key] = append(reported[key], parent.Conditions...)
+	}
+
+	var accepted, pending []string
+parents:
+	for _, ref := range cr.Spec.Gateway.ParentRefs {
+		name := parentName(ref.Namespace, ref.Name, ref.SectionName)
+		for _, conditionType := range []string{"Accepted", "ResolvedRefs"} {
+			c := meta.FindStatusCondition(reported[name], conditionType)
+			if c == nil {
+				pending = append(pending, name)
+				continue parents
+			}
+			if c.Status != metav1.ConditionTrue {
+				return c.Reason, "Gateway " + name + ": " + c.Message
+			}
+		}
+		accepted = append(accepted, name)
+	}
+	if len(pending) > 0 {
+		return "Pending", "Waiting for Gateway " + strings.Join(pending, ", ") + " to accept HTTPRoute " + route.GetName()
+	}
+	return "Accepted", "HTTPRoute " + route.GetName() + " is accepted by Gateway " + strings.Join(accepted, ", ")
+}
+
+// Check if General Status or the Ready condition was changed, if yes update it.
+// The optional conditions are set when not nil and removed otherwise.
+func (r *LearnReconciler) insertUpdateGeneralStatus(ctx context.Context, cr *devopsv1alpha1.Learn, statusMsgUpdate string, optional map[string]*metav1.Condition) error {
+	conditions := append([]metav1.Condition{}, cr.Status.Conditions...)
+	meta.SetStatusCondition(&conditions, readyCondition(cr, statusMsgUpdate))
+	// Sorted, so the order of the conditions does not change between reconciles
+	optionalTypes := make([]string, 0, len(optional))
+	for conditionType := range optional {
+		optionalTypes = append(optionalTypes, conditionType)
+	}
+	sort.Strings(optionalTypes)
+	for _, conditionType := range optionalTypes {
+		if condition := optional[conditionType]; condition != nil {
+			meta.SetStatusCondition(&conditions, *condition)
+		} else {
+			meta.RemoveStatusCondition(&conditions, conditionType)
+		}
+	}
+	if paused := pausedCondition(cr); paused != nil {
+		meta.SetStatusCondition(&conditions, *paused)
+	} else {
+		meta.RemoveStatusCondition(&conditions, devopsv1alpha1.ConditionPaused)
+	}
+	// Only a reconcile failing on the resources of the Learn sets the Conflict condition
+	meta.RemoveStatusCondition(&conditions, devopsv1alpha1.ConditionConflict)
+	specHash := cr.SpecHash()
+	// The plan of a previous Plan mode is stale once the Learn applies its changes
+	stalePlan := cr.Spec.ReconcileMode != devopsv1alpha1.ReconcilePlan && cr.Status.PlannedChanges != nil
+	if statusMsgUpdate != cr.Status.Status || specHash != cr.Status.SpecHash || stalePlan || !reflect.DeepEqual(conditions, cr.Status.Conditions) {
 		cr.Status.Status = statusMsgUpdate
+		cr.Status.SpecHash = specHash
+		cr.Status.Conditions = conditions
+		if stalePlan {
+			cr.Status.PlannedChanges = nil
+		}
 		if err := r.Status().Update(ctx, cr); err != nil {
 			return err
 		}
@@ -83,9 +284,82 @@ func (r *LearnReconciler) insertUpdateGeneralStatus(cr *devopsv1alpha1.Learn, st
 	return nil
 }
 
+// pausedCondition returns the Paused condition, nil when the operator manages the Learn
+func pausedCondition(cr *devopsv1alpha1.Learn) *metav1.Condition {
+	condition := &metav1.Condition{
+		Type:               devopsv1alpha1.ConditionPaused,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: cr.Generation,
+	}
+	switch {
+	case cr.IsPaused():
+		condition.Reason = "Paused"
+		condition.Message = "The " + devopsv1alpha1.AnnotationPaused + " annotation freezes the resources of the Learn"
+	case cr.AwaitsApproval():
+		condition.Reason = "AwaitingApproval"
+		condition.Message = "Set the " + devopsv1alpha1.AnnotationApprovedSpecHash + " annotation to " + cr.SpecHash() + " to apply the spec"
+	default:
+		return nil
+	}
+	return condition
+}
+
+// readyCondition returns the Ready condition matching the general status message
+func readyCondition(cr *devopsv1alpha1.Learn, statusMsg string) metav1.Condition {
+	if statusMsg == statusOk {
+		return metav1.Condition{
+			Type:               devopsv1alpha1.ConditionReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             "ResourcesReady",
+			Message:            "All the resources required by the Learn exist",
+			ObservedGeneration: cr.Generation,
+		}
+	}
+	return metav1.Condition{
+		Type:               devopsv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ResourcesMissing",
+		Message:            statusMsg,
+		ObservedGeneration: cr.Generation,
+	}
+}
+
+// updateFailedCondition sets the Ready condition of the Learn to False with the
+// main class of err as its reason, so a reconcile failing on an API error says
+// why. A resource the Learn may not adopt also sets the Conflict condition.
+func (r *LearnReconciler) updateFailedCondition(ctx context.Context, request reconcile.Request, classes []ErrorClass, err error) error {
+	cr := &devopsv1alpha1.Learn{}
+	if err := r.Get(ctx, request.NamespacedName, cr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	conditions := append([]metav1.Condition{}, cr.Status.Conditions...)
+	meta.SetStatusCondition(&conditions, metav1.Condition{
+		Type:               devopsv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             string(failureReason(classes)),
+		Message:            err.Error(),
+		ObservedGeneration: cr.Generation,
+	})
+	for _, class := range classes {
+		if class == ErrorNotOwned {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               devopsv1alpha1.ConditionConflict,
+				Status:             metav1.ConditionTrue,
+				Reason:             string(ErrorNotOwned),
+				Message:            err.Error(),
+				ObservedGeneration: cr.Generation,
+			})
+		}
+	}
+	if reflect.DeepEqual(conditions, cr.Status.Conditions) {
+		return nil
+	}
+	cr.Status.Conditions = conditions
+	return r.Status().Update(ctx, cr)
+}
+
 //updateDeploymentStatus returns error when status regards the deployment resource could not be updated
-func (r *LearnReconciler) updateDeploymentStatus(request reconcile.Request) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) updateDeploymentStatus(ctx context.Context, request reconcile.Request) error {
 	Status := &devopsv1alpha1.Learn{}
 	err := r.Get(ctx, types.NamespacedName{
 		Name:      request.Name,
@@ -97,16 +371,24 @@ func (r *LearnReconciler) updateDeploymentStatus(request reconcile.Request) erro
 
 	deployment := &appsv1.Deployment{}
 	err = r.Get(ctx, types.NamespacedName{
-		Name:      request.Name,
+		Name:      Status.AppName(),
 		Namespace: request.Namespace,
 	}, deployment)
 
 	if err != nil {
-		return err
+		// A missing Deployment is reported by the general status
+		return client.IgnoreNotFound(err)
 	}
+	// So is a Deployment of the same name the Learn does not control, its
+	// status is not the one of the app
+	if !metav1.IsControlledBy(deployment, Status) {
+		return nil
+	}
+
+	rollouts.observe(request.NamespacedName, deployment)
 
 	// Check if Deployment Status was changed, if yes update it
-	if err := r.insertUpdateDeploymentStatus(deployment, Status); err != nil {
+	if err := r.insertUpdateDeploymentStatus(ctx, deployment, Status); err != nil {
 		return err
 	}
 
@@ -114,8 +396,7 @@ func (r *LearnReconciler) updateDeploymentStatus(request reconcile.Request) erro
 }
 
 // insertUpdateDeploymentStatus will check if Deployment status changed, if yes then and update it
-func (r *LearnReconciler) insertUpdateDeploymentStatus(deployment *appsv1.Deployment, cr *devopsv1alpha1.Learn) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) insertUpdateDeploymentStatus(ctx context.Context, deployment *appsv1.Deployment, cr *devopsv1alpha1.Learn) error {
 	if !reflect.DeepEqual(deployment.Status, cr.Status.DeploymentStatus) {
 		cr.Status.DeploymentStatus = deployment.Status
 		if err := r.Status().Update(ctx, cr); err != nil {
@@ -126,8 +407,7 @@ func (r *LearnReconciler) insertUpdateDeploymentStatus(deployment *appsv1.Deploy
 }
 
 //updateHorizontalPodAutoscalerStatus returns error when status regards the HorizontalPodAutoscaler resource could not be updated
-func (r *LearnReconciler) updateHorizontalPodAutoscalerStatus(request reconcile.Request) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) updateHorizontalPodAutoscalerStatus(ctx context.Context, request reconcile.Request) error {
 	learn := &devopsv1alpha1.Learn{}
 	err := r.Get(ctx, types.NamespacedName{
 		Name:      request.Name,
@@ -138,7 +418,7 @@ func (r *LearnReconciler) updateHorizontalPodAutoscalerStatus(request reconcile.
 	}
 	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
 	err = r.Get(ctx, types.NamespacedName{
-		Name:      request.Name,
+		Name:      learn.AppName(),
 		Namespace: request.Namespace,
 	}, hpa)
 	if err != nil {
@@ -146,7 +426,7 @@ func (r *LearnReconciler) updateHorizontalPodAutoscalerStatus(request reconcile.
 	}
 
 	// Check if HorizontalPodAutoscaler Status was changed, if yes update it
-	if err := r.insertUpdateHorizontalPodAutoscalerStatus(hpa, learn); err != nil {
+	if err := r.insertUpdateHorizontalPodAutoscalerStatus(ctx, hpa, learn); err != nil {
 		return err
 	}
 
@@ -154,8 +434,7 @@ func (r *LearnReconciler) updateHorizontalPodAutoscalerStatus(request reconcile.
 }
 
 // insertUpdateDeploymentStatus will check if HorizontalPodAutoscaler status changed, if yes then and update it
-func (r *LearnReconciler) insertUpdateHorizontalPodAutoscalerStatus(hpaStatus *autoscalingv2beta2.HorizontalPodAutoscaler, cr *devopsv1alpha1.Learn) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) insertUpdateHorizontalPodAutoscalerStatus(ctx context.Context, hpaStatus *autoscalingv2beta2.HorizontalPodAutoscaler, cr *devopsv1alpha1.Learn) error {
 	if !reflect.DeepEqual(hpaStatus.Status, cr.Status.ServiceStatus) {
 		// cr.Status.HorizontalPodAutoscalerStatus = hpaStatus.DeepCopy().Status
 		if err := r.Status().Update(ctx, cr); err != nil {
@@ -166,8 +445,7 @@ func (r *LearnReconciler) insertUpdateHorizontalPodAutoscalerStatus(hpaStatus *a
 }
 
 //updateServiceStatus returns error when status regards the service resource could not be updated
-func (r *LearnReconciler) updateServiceStatus(request reconcile.Request) error {
-	ctx := context.TODO()
+func (r *LearnReconciler) updateServiceStatus(ctx context.Context, request reconcile.Request) error {
 	learn := &devopsv1alpha1.Learn{}
 	err := r.Get(ctx, types.NamespacedName{
 		Name:      request.Name,
@@ -178,26 +456,33 @@ func (r *LearnReconciler) updateServiceStatus(request reconcile.Request) error {
 	}
 	srv := &corev1.Service{}
 	err = r.Get(ctx, types.NamespacedName{
-		Name:      request.Name,
+		Name:      learn.AppName(),
 		Namespace: request.Namespace,
 	}, srv)
 	if err != nil {
-		return err
+		// A missing Service is reported by the general status
+		return client.IgnoreNotFound(err)
+	}
+	// So is a Service of the same name the Learn does not control, its
+	// status and endpoints are not the ones of the app
+	if !metav1.IsControlledBy(srv, learn) {
+		return nil
 	}
 
 	// Check if Service Status was changed, if yes update it
-	if err := r.insertUpdateServiceStatus(srv, learn); err != nil {
+	if err := r.insertUpdateServiceStatus(ctx, srv, learn); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// insertUpdateDeploymentStatus will check if Service status changed, if yes then and update it
-func (r *LearnReconciler) insertUpdateServiceStatus(serviceStatus *corev1.Service, cr *devopsv1alpha1.Learn) error {
-	ctx := context.TODO()
-	if !reflect.DeepEqual(serviceStatus.Status, cr.Status.ServiceStatus) {
+// insertUpdateDeploymentStatus will check if Service status or its endpoints changed, if yes then and update it
+func (r *LearnReconciler) insertUpdateServiceStatus(ctx context.Context, serviceStatus *corev1.Service, cr *devopsv1alpha1.Learn) error {
+	endpoints := serviceEndpoints(serviceStatus)
+	if !reflect.DeepEqual(serviceStatus.Status, cr.Status.ServiceStatus) || !reflect.DeepEqual(endpoints, cr.Status.Endpoints) {
 		cr.Status.ServiceStatus = serviceStatus.Status
+		cr.Status.Endpoints = endpoints
 		if err := r.Status().Update(ctx, cr); err != nil {
 			return err
 		}
@@ -206,9 +491,8 @@ func (r *LearnReconciler) insertUpdateServiceStatus(serviceStatus *corev1.Servic
 }
 
 //validateBackup returns error when some requirement is missing
-func (r *LearnReconciler) isAllCreated(cr *devopsv1alpha1.Learn) error {
+func (r *LearnReconciler) isAllCreated(ctx context.Context, cr *devopsv1alpha1.Learn) error {
 	// Check if the Deployment was created
-	ctx := context.TODO()
 	err := r.Get(ctx, types.NamespacedName{
 		Name:      cr.Name,
 		Namespace: cr.Namespace,
@@ -217,31 +501,32 @@ func (r *LearnReconciler) isAllCreated(cr *devopsv1alpha1.Learn) error {
 		return err
 	}
 
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, &appsv1.Deployment{})
-
-	if err != nil {
+	// The resources named like the Learn only count when the Learn controls them
+	key := types.NamespacedName{Name: cr.AppName(), Namespace: cr.Namespace}
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, deployment); err != nil {
 		return fmt.Errorf("Error: Deployment is missing.")
 	}
-
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, &autoscalingv2beta2.HorizontalPodAutoscaler{})
-
-	if err != nil {
-		return fmt.Errorf("Error: HorizontalPodAutoscaler is missing.")
+	if !metav1.IsControlledBy(deployment, cr) {
+		return fmt.Errorf("Error: Deployment is not owned by the Learn.")
 	}
 
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      cr.Name,
-		Namespace: cr.Namespace,
-	}, &corev1.Service{})
+	if cr.AppAutoscaling() != nil {
+		hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+		if err := r.Get(ctx, key, hpa); err != nil {
+			return fmt.Errorf("Error: HorizontalPodAutoscaler is missing.")
+		}
+		if !metav1.IsControlledBy(hpa, cr) {
+			return fmt.Errorf("Error: HorizontalPodAutoscaler is not owned by the Learn.")
+		}
+	}
 
-	if err != nil {
+	service := &corev1.Service{}
+	if err := r.Get(ctx, key, service); err != nil {
 		return fmt.Errorf("Error: Service is missing.")
 	}
-	return err
+	if !metav1.IsControlledBy(service, cr) {
+		return fmt.Errorf("Error: Service is not owned by the Learn.")
+	}
+	return nil
 }
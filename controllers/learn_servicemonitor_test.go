@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// monitoredLearn returns a Learn scraped by a ServiceMonitor every 30s
+func monitoredLearn() *devopsv1alpha1.Learn {
+	return &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid", Finalizers: []string{statusFinalizer}},
+		Spec: devopsv1alpha1.LearnSpec{
+			Image:      "dxas90/learn:1.0.0",
+			Replicas:   2,
+			Monitoring: &devopsv1alpha1.MonitoringSpec{Enabled: true, Port: 9090, Interval: "30s", Labels: map[string]string{"release": "prometheus"}},
+		},
+	}
+}
+
+// installServiceMonitorCRD makes the RESTMapper of r serve the ServiceMonitor kind
+func installServiceMonitorCRD(r *LearnReconciler) {
+	r.Client.(restMapperClient).mapper.(*meta.DefaultRESTMapper).Add(serviceMonitorGVK, meta.RESTScopeNamespace)
+}
+
+// reconcileMonitoring reconciles the Learn of key and returns its ServiceMonitorReady condition
+func reconcileMonitoring(t *testing.T, r *LearnReconciler, key types.NamespacedName) *metav1.Condition {
+	t.Helper()
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	if err != nil || result.Requeue {
+		t.Fatalf("Reconcile() = %+v, %v, want no error and no retry", result, err)
+	}
+	return meta.FindStatusCondition(getLearn(t, r, key).Status.Conditions, devopsv1alpha1.ConditionServiceMonitorReady)
+}
+
+func TestReconcileCreatesServiceMonitor(t *testing.T) {
+	learn := monitoredLearn()
+	r := newFakeReconciler(learn)
+	installServiceMonitorCRD(r)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+	if c := reconcileMonitoring(t, r, key); c == nil || c.Status != metav1.ConditionTrue || c.Reason != "Created" {
+		t.Errorf("ServiceMonitorReady condition = %+v, want True once created", c)
+	}
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	if err := r.Get(ctx, key, sm); err != nil {
+		t.Fatalf("ServiceMonitor not created: %v", err)
+	}
+	if !metav1.IsControlledBy(sm, learn) || sm.GetLabels()["release"] != "prometheus" {
+		t.Errorf("ServiceMonitor owners = %v, labels = %v, want it owned by the Learn with the monitoring labels", sm.GetOwnerReferences(), sm.GetLabels())
+	}
+	endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	if len(endpoints) != 1 {
+		t.Fatalf("ServiceMonitor endpoints = %v, want one", endpoints)
+	}
+	if endpoint := endpoints[0].(map[string]interface{}); endpoint["port"] != "metrics" || endpoint["path"] != "/metrics" || endpoint["interval"] != "30s" {
+		t.Errorf("ServiceMonitor endpoint = %v, want the metrics port scraped on /metrics every 30s", endpoint)
+	}
+
+	// A drifted spec is brought back
+	if err := unstructured.SetNestedField(sm.Object, "/other", "spec", "endpoints"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(ctx, sm); err != nil {
+		t.Fatal(err)
+	}
+	reconcileMonitoring(t, r, key)
+	if err := r.Get(ctx, key, sm); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints"); len(endpoints) != 1 {
+		t.Errorf("ServiceMonitor endpoints = %v, want the drift corrected", sm.Object["spec"])
+	}
+
+	// Disabling monitoring prunes the ServiceMonitor and its condition
+	live := getLearn(t, r, key)
+	live.Spec.Monitoring.Enabled = false
+	if err := r.Update(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	if c := reconcileMonitoring(t, r, key); c != nil {
+		t.Errorf("ServiceMonitorReady condition = %+v, want none without monitoring", c)
+	}
+	if err := r.Get(ctx, key, sm); !errors.IsNotFound(err) {
+		t.Errorf("ServiceMonitor still exists after monitoring was disabled, error = %v", err)
+	}
+}
+
+func TestReconcileWithoutServiceMonitorCRD(t *testing.T) {
+	learn := monitoredLearn()
+	r := newFakeReconciler(learn)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+	// The missing CRD is reported, not retried as an error
+	for i := 0; i < 2; i++ {
+		c := reconcileMonitoring(t, r, key)
+		if c == nil || c.Status != metav1.ConditionFalse || c.Reason != "CRDNotInstalled" {
+			t.Errorf("ServiceMonitorReady condition = %+v, want False because the CRD is not installed", c)
+		}
+	}
+	ready := meta.FindStatusCondition(getLearn(t, r, key).Status.Conditions, devopsv1alpha1.ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready condition = %+v, want the app Ready without the ServiceMonitor", ready)
+	}
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	if err := r.Get(ctx, key, sm); err == nil {
+		t.Errorf("ServiceMonitor created without its CRD")
+	}
+}
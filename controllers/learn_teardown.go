@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// teardownPollInterval is how often a teardown in progress is checked
+	teardownPollInterval = 5 * time.Second
+	// defaultScaleDownTimeout bounds the wait for the pods of the app to stop
+	defaultScaleDownTimeout = 120 * time.Second
+	// defaultPreDeleteTimeout bounds the run of the pre-delete Job
+	defaultPreDeleteTimeout = 300 * time.Second
+	// preDeleteSuffix names the pre-delete Job after the Learn
+	preDeleteSuffix = "-pre-delete"
+)
+
+// Reasons of the Events recorded during a teardown
+const (
+	// ReasonScaleDownTimedOut is recorded when the pods outlive the scale down timeout
+	ReasonScaleDownTimedOut = "ScaleDownTimedOut"
+	// ReasonPreDeleteFailed is recorded when the pre-delete Job fails or times out
+	ReasonPreDeleteFailed = "PreDeleteFailed"
+)
+
+// teardown removes the app of a deleted Learn in order: the autoscaler is
+// deleted and the Deployment scaled to zero, then the pre-delete Job runs. The
+// progress is kept in status.teardown, a zero result means the finalizer can go.
+func (r *LearnReconciler) teardown(ctx context.Context, cr *devopsv1alpha1.Learn) (ctrl.Result, error) {
+	if cr.Status.Teardown == nil {
+		if err := r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownScalingDown, "Scaling the app down"); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	for {
+		status := cr.Status.Teardown
+		elapsed := time.Since(status.PhaseStarted.Time)
+		switch status.Phase {
+		case devopsv1alpha1.TeardownScalingDown:
+			stopped, err := r.scaleDown(ctx, cr)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !stopped {
+				if elapsed < scaleDownTimeout(cr) {
+					return ctrl.Result{RequeueAfter: teardownPollInterval}, nil
+				}
+				r.recordWarning(cr, ReasonScaleDownTimedOut, fmt.Errorf("the pods of %s did not stop within %s", cr.Name, scaleDownTimeout(cr)))
+			}
+			if preDeleteHook(cr) == nil {
+				return ctrl.Result{}, r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownCompleted, "The app is scaled down")
+			}
+			if err := r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownPreDelete, "Running the pre-delete Job"); err != nil {
+				return ctrl.Result{}, err
+			}
+
+		case devopsv1alpha1.TeardownPreDelete, devopsv1alpha1.TeardownBlocked:
+			hook := preDeleteHook(cr)
+			if hook == nil {
+				return ctrl.Result{}, r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownCompleted, "The pre-delete Job was removed from the spec")
+			}
+			finished, failure, err := r.runPreDeleteJob(ctx, cr)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !finished && elapsed < preDeleteTimeout(cr) {
+				return ctrl.Result{RequeueAfter: teardownPollInterval}, nil
+			}
+			if !finished {
+				failure = fmt.Sprintf("the pre-delete Job did not finish within %s", preDeleteTimeout(cr))
+			}
+			if failure == "" {
+				return ctrl.Result{}, r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownCompleted, "The pre-delete Job succeeded")
+			}
+			if hook.FailurePolicy == devopsv1alpha1.PreDeleteAbort {
+				if status.Phase != devopsv1alpha1.TeardownBlocked {
+					r.recordWarning(cr, ReasonPreDeleteFailed, fmt.Errorf("%s, the Learn is kept", failure))
+				}
+				// Wait for the user to fix the spec, its update requeues the Learn
+				return ctrl.Result{}, r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownBlocked, failure)
+			}
+			r.recordWarning(cr, ReasonPreDeleteFailed, fmt.Errorf("%s, removing the Learn anyway", failure))
+			return ctrl.Result{}, r.setTeardownPhase(ctx, cr, devopsv1alpha1.TeardownCompleted, failure)
+
+		default:
+			return ctrl.Result{}, nil
+		}
+	}
+}
+
+// setTeardownPhase records the teardown phase in the status of the Learn
+func (r *LearnReconciler) setTeardownPhase(ctx context.Context, cr *devopsv1alpha1.Learn, phase devopsv1alpha1.TeardownPhase, message string) error {
+	status := cr.Status.Teardown
+	if status != nil && status.Phase == phase && status.Message == message {
+		return nil
+	}
+	if status == nil || status.Phase != phase {
+		status = &devopsv1alpha1.TeardownStatus{Phase: phase, PhaseStarted: metav1.Now()}
+	}
+	status.Message = message
+	cr.Status.Teardown = status
+	return r.Status().Update(ctx, cr)
+}
+
+// scaleDown deletes the autoscaler and scales the Deployment to zero. It
+// reports whether the pods of the app are gone. An autoscaler or a Deployment
+// named like the ones of the app that the Learn does not control belongs to
+// someone else, it is left alone and counts as gone.
+func (r *LearnReconciler) scaleDown(ctx context.Context, cr *devopsv1alpha1.Learn) (bool, error) {
+	key := client.ObjectKey{Name: cr.AppName(), Namespace: cr.Namespace}
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	if err := r.Get(ctx, key, hpa); err == nil {
+		// The autoscaler would scale the Deployment back up
+		if metav1.IsControlledBy(hpa, cr) {
+			if err := r.deleteOwned(ctx, cr, hpa); err != nil {
+				return false, err
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !metav1.IsControlledBy(dep, cr) {
+		return true, nil
+	}
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != 0 {
+		var zero int32
+		dep.Spec.Replicas = &zero
+		if err := r.updateOwned(ctx, cr, dep); err != nil {
+			return false, err
+		}
+	}
+	return dep.Status.Replicas == 0, nil
+}
+
+// runPreDeleteJob creates the pre-delete Job if needed. It reports whether
+// the Job finished and, when it failed, why.
+func (r *LearnReconciler) runPreDeleteJob(ctx context.Context, cr *devopsv1alpha1.Learn) (bool, string, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: cr.AppName() + preDeleteSuffix, Namespace: cr.Namespace}, job)
+	if errors.IsNotFound(err) {
+		log.FromContext(ctx).Info("Creating the pre-delete Job", "name", cr.AppName()+preDeleteSuffix)
+		return false, "", r.createOwned(ctx, cr, NewPreDeleteJob(cr, r.Scheme))
+	}
+	if err != nil {
+		return false, "", err
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, "", nil
+		case batchv1.JobFailed:
+			return true, fmt.Sprintf("the pre-delete Job failed: %s", condition.Message), nil
+		}
+	}
+	return false, "", nil
+}
+
+// NewPreDeleteJob returns the Job run before the resources of a deleted Learn are removed
+func NewPreDeleteJob(cr *devopsv1alpha1.Learn, scheme *runtime.Scheme) *batchv1.Job {
+	hook := preDeleteHook(cr)
+	options := cr.AppPodOptions()
+	image := hook.Image
+	if image == "" {
+		image = cr.AppImage()
+	}
+	deadline := int64(preDeleteTimeout(cr) / time.Second)
+	var backoffLimit int32
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.AppName() + preDeleteSuffix,
+			Namespace: cr.Namespace,
+			Labels:    appLabels(cr),
+		},
+		Spec: batchv1.JobSpec{
+			ActiveDeadlineSeconds: &deadline,
+			BackoffLimit:          &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					// Not the app labels, the Service must not send traffic to the Job
+					Labels: map[string]string{"devops-job": cr.AppName() + preDeleteSuffix},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: options.ServiceAccountName,
+					Containers: []corev1.Container{
+						{
+							Name:            "pre-delete",
+							Image:           image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command:         hook.Command,
+							Args:            hook.Args,
+							Env:             hook.Env,
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									ConfigMapRef: &corev1.ConfigMapEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: options.ConfigMapName,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	// Set cr as the owner and controller
+	controllerutil.SetControllerReference(cr, job, scheme)
+	return job
+}
+
+// preDeleteHook returns the pre-delete Job of the Learn, nil when it has none
+func preDeleteHook(cr *devopsv1alpha1.Learn) *devopsv1alpha1.PreDeleteHook {
+	if cr.Spec.Teardown == nil {
+		return nil
+	}
+	return cr.Spec.Teardown.PreDelete
+}
+
+// scaleDownTimeout returns how long the teardown waits for the pods to stop
+func scaleDownTimeout(cr *devopsv1alpha1.Learn) time.Duration {
+	if cr.Spec.Teardown == nil || cr.Spec.Teardown.ScaleDownTimeoutSeconds == 0 {
+		return defaultScaleDownTimeout
+	}
+	return time.Duration(cr.Spec.Teardown.ScaleDownTimeoutSeconds) * time.Second
+}
+
+// preDeleteTimeout returns how long the pre-delete Job may run
+func preDeleteTimeout(cr *devopsv1alpha1.Learn) time.Duration {
+	hook := preDeleteHook(cr)
+	if hook == nil || hook.TimeoutSeconds == 0 {
+		return defaultPreDeleteTimeout
+	}
+	return time.Duration(hook.TimeoutSeconds) * time.Second
+}
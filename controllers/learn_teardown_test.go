@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// deletedLearn returns a Learn being deleted
+func deletedLearn(teardown *devopsv1alpha1.TeardownSpec) *devopsv1alpha1.Learn {
+	now := metav1.Now()
+	return &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "teardown", Namespace: "default", UID: "teardown-uid",
+			Finalizers: []string{statusFinalizer}, DeletionTimestamp: &now,
+		},
+		Spec: devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Teardown: teardown},
+	}
+}
+
+// newTeardownReconciler returns a reconciler seeded with learn, its running
+// Deployment and its autoscaler
+func newTeardownReconciler(t *testing.T, learn *devopsv1alpha1.Learn) (*LearnReconciler, ctrl.Request) {
+	t.Helper()
+	s := newFakeReconciler().Scheme
+	dep := NewDeploymentForCR(learn, s)
+	dep.Status.Replicas = 2
+	r := newFakeReconciler(learn, dep, NewHorizontalPodAutoscalerForCR(learn, s))
+	return r, ctrl.Request{NamespacedName: types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}}
+}
+
+func getLearn(t *testing.T, r *LearnReconciler, key types.NamespacedName) *devopsv1alpha1.Learn {
+	t.Helper()
+	learn := &devopsv1alpha1.Learn{}
+	if err := r.Get(context.Background(), key, learn); err != nil {
+		t.Fatal(err)
+	}
+	return learn
+}
+
+func TestTeardownScalesDownWithoutRecreatingChildren(t *testing.T) {
+	r, req := newTeardownReconciler(t, deletedLearn(nil))
+	ctx := context.Background()
+
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("Reconcile() did not requeue while the pods are running")
+	}
+	if err := r.Get(ctx, req.NamespacedName, &autoscalingv2beta2.HorizontalPodAutoscaler{}); !errors.IsNotFound(err) {
+		t.Errorf("HorizontalPodAutoscaler not deleted: %v", err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "teardown-conf", Namespace: "default"}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("ConfigMap created on a Learn being deleted: %v", err)
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, dep); err != nil {
+		t.Fatal(err)
+	}
+	if *dep.Spec.Replicas != 0 {
+		t.Errorf("Deployment replicas = %d, want 0", *dep.Spec.Replicas)
+	}
+	if phase := getLearn(t, r, req.NamespacedName).Status.Teardown.Phase; phase != devopsv1alpha1.TeardownScalingDown {
+		t.Errorf("teardown phase = %q, want ScalingDown", phase)
+	}
+
+	dep.Status.Replicas = 0
+	if err := r.Status().Update(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	learn := getLearn(t, r, req.NamespacedName)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownCompleted || len(learn.Finalizers) != 0 {
+		t.Errorf("teardown = %+v finalizers = %v, want Completed without finalizer", learn.Status.Teardown, learn.Finalizers)
+	}
+}
+
+// runPreDelete scales the app down and finishes the pre-delete Job with condition
+func runPreDelete(t *testing.T, hook *devopsv1alpha1.PreDeleteHook, condition batchv1.JobConditionType) (*LearnReconciler, ctrl.Request) {
+	t.Helper()
+	learn := deletedLearn(&devopsv1alpha1.TeardownSpec{PreDelete: hook})
+	r, req := newTeardownReconciler(t, learn)
+	ctx := context.Background()
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, dep); err != nil {
+		t.Fatal(err)
+	}
+	dep.Status.Replicas = 0
+	if err := r.Status().Update(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.Reconcile(ctx, req); err != nil || result.RequeueAfter == 0 {
+		t.Fatalf("Reconcile() = %v, %v, want a requeue while the Job runs", result, err)
+	}
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "teardown-pre-delete", Namespace: "default"}, job); err != nil {
+		t.Fatalf("pre-delete Job not created: %v", err)
+	}
+	if job.Spec.Template.Spec.Containers[0].Image != learn.Spec.Image {
+		t.Errorf("Job image = %q, want the app image", job.Spec.Template.Spec.Containers[0].Image)
+	}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+		if err := r.Status().Update(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	return r, req
+}
+
+func TestTeardownWaitsForPreDeleteJob(t *testing.T) {
+	r, req := runPreDelete(t, &devopsv1alpha1.PreDeleteHook{Command: []string{"drain"}}, batchv1.JobComplete)
+	learn := getLearn(t, r, req.NamespacedName)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownCompleted || len(learn.Finalizers) != 0 {
+		t.Errorf("teardown = %+v finalizers = %v, want Completed without finalizer", learn.Status.Teardown, learn.Finalizers)
+	}
+}
+
+func TestTeardownAbortKeepsLearn(t *testing.T) {
+	hook := &devopsv1alpha1.PreDeleteHook{FailurePolicy: devopsv1alpha1.PreDeleteAbort}
+	r, req := runPreDelete(t, hook, batchv1.JobFailed)
+	learn := getLearn(t, r, req.NamespacedName)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownBlocked || len(learn.Finalizers) != 1 {
+		t.Errorf("teardown = %+v finalizers = %v, want Blocked with the finalizer", learn.Status.Teardown, learn.Finalizers)
+	}
+}
+
+func TestTeardownPreDeleteTimeout(t *testing.T) {
+	r, req := runPreDelete(t, &devopsv1alpha1.PreDeleteHook{TimeoutSeconds: 60}, "")
+	ctx := context.Background()
+	learn := getLearn(t, r, req.NamespacedName)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownPreDelete {
+		t.Fatalf("teardown phase = %q, want PreDelete while the Job runs", learn.Status.Teardown.Phase)
+	}
+	learn.Status.Teardown.PhaseStarted = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	if err := r.Status().Update(ctx, learn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	learn = getLearn(t, r, req.NamespacedName)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownCompleted || len(learn.Finalizers) != 0 {
+		t.Errorf("teardown = %+v finalizers = %v, want Completed after the timeout", learn.Status.Teardown, learn.Finalizers)
+	}
+}
+
+func TestTeardownLeavesForeignResources(t *testing.T) {
+	learn := deletedLearn(nil)
+	s := newFakeReconciler().Scheme
+	// Another team runs the Deployment and the autoscaler named like the app
+	dep := NewDeploymentForCR(learn, s)
+	dep.OwnerReferences = nil
+	replicas := int32(2)
+	dep.Spec.Replicas = &replicas
+	dep.Status.Replicas = 2
+	hpa := NewHorizontalPodAutoscalerForCR(learn, s)
+	hpa.OwnerReferences = nil
+	r := newFakeReconciler(learn, dep, hpa)
+	counting := &writeCountingClient{Client: r.Client}
+	r.Client = counting
+	ctx := context.Background()
+	key := types.NamespacedName{Name: learn.Name, Namespace: learn.Namespace}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	for _, write := range counting.writes {
+		if write == "delete *v2beta2.HorizontalPodAutoscaler teardown" || write == "update *v1.Deployment teardown" {
+			t.Errorf("teardown wrote %q on a resource the Learn does not control", write)
+		}
+	}
+	if err := r.Get(ctx, key, &autoscalingv2beta2.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("foreign HorizontalPodAutoscaler deleted: %v", err)
+	}
+	live := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Spec.Replicas == nil || *live.Spec.Replicas == 0 {
+		t.Errorf("foreign Deployment scaled to %v, want it left alone", live.Spec.Replicas)
+	}
+	// The foreign pods do not hold the teardown back
+	learn = getLearn(t, r, key)
+	if learn.Status.Teardown.Phase != devopsv1alpha1.TeardownCompleted || len(learn.Finalizers) != 0 {
+		t.Errorf("teardown = %+v finalizers = %v, want Completed without finalizer", learn.Status.Teardown, learn.Finalizers)
+	}
+}
+
+func TestOwnedClientRefusesForeignWrites(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{ObjectMeta: metav1.ObjectMeta{Name: "learn-sample", Namespace: "default", UID: "learn-uid"}}
+	svc := foreignService(nil, nil)
+	r := newFakeReconciler(learn, svc)
+	ctx := context.Background()
+
+	for verb, write := range map[string]func() error{
+		"update": func() error { return r.owned().update(ctx, learn, svc) },
+		"delete": func() error { return r.owned().delete(ctx, learn, svc) },
+	} {
+		var notOwned *NotOwnedError
+		if err := write(); !goerrors.As(err, &notOwned) {
+			t.Errorf("%s of a foreign Service error = %v, want a NotOwnedError", verb, err)
+		}
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, &corev1.Service{}); err != nil {
+		t.Errorf("foreign Service deleted: %v", err)
+	}
+}
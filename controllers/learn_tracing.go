@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// tracerName is the instrumentation name of the spans started by the Learn controller
+const tracerName = "github.com/dxas90/learn-operator/controllers"
+
+// Attributes set on every span of a Learn reconcile
+var (
+	attrLearnName      = attribute.Key("learn.name")
+	attrLearnNamespace = attribute.Key("learn.namespace")
+	attrResourceKind   = attribute.Key("resource.kind")
+)
+
+// tracer returns the tracer of the reconciler, the global one when no TracerProvider is set
+func (r *LearnReconciler) tracer() trace.Tracer {
+	if r.TracerProvider != nil {
+		return r.TracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startSpan starts a span named name carrying the name and namespace of the Learn
+func (r *LearnReconciler) startSpan(ctx context.Context, name string, learn types.NamespacedName, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attrLearnName.String(learn.Name), attrLearnNamespace.String(learn.Namespace))
+	return r.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// traceStep runs step inside a span named name. kind is the resource kind the
+// step works on, it is left out of the attributes when empty.
+func (r *LearnReconciler) traceStep(ctx context.Context, learn types.NamespacedName, name, kind string, step func(context.Context) error) error {
+	var attrs []attribute.KeyValue
+	if kind != "" {
+		attrs = append(attrs, attrResourceKind.String(kind))
+	}
+	ctx, span := r.startSpan(ctx, name, learn, attrs...)
+	defer span.End()
+
+	err := step(ctx)
+	recordSpanError(span, err)
+	return err
+}
+
+// recordSpanError marks span as failed when err is not nil
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
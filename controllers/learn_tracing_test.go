@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileSpans(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "traced", Namespace: "default", Finalizers: []string{statusFinalizer}},
+		Spec:       devopsv1alpha1.LearnSpec{Image: "dxas90/learn:1.0.0", Replicas: 1},
+	}
+	r := newFakeReconciler(learn)
+	exporter := tracetest.NewInMemoryExporter()
+	r.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "traced", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["Reconcile"]
+	if !ok {
+		t.Fatalf("no Reconcile span in %v", spanNames(exporter))
+	}
+	wantKinds := map[string]string{
+		"createResources":        "",
+		"createConfigMapsCR":     "ConfigMap",
+		"createServiceAccountCR": "ServiceAccount",
+		"createDeploymentCR":     "Deployment",
+		"createServiceCR":        "Service",
+		"createHpaCR":            "HorizontalPodAutoscaler",
+		"updateDeploymentStatus": "Deployment",
+		"updateServiceStatus":    "Service",
+		"updateStatus":           "",
+	}
+	for name, kind := range wantKinds {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span in %v", name, spanNames(exporter))
+			continue
+		}
+		if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("span %s is not part of the Reconcile trace", name)
+		}
+		attrs := attributeMap(span.Attributes)
+		if attrs[attrLearnName] != "traced" || attrs[attrLearnNamespace] != "default" {
+			t.Errorf("span %s attributes = %v, want the Learn name and namespace", name, attrs)
+		}
+		if attrs[attrResourceKind] != kind {
+			t.Errorf("span %s resource.kind = %q, want %q", name, attrs[attrResourceKind], kind)
+		}
+	}
+	if parent := spans["createDeploymentCR"].Parent.SpanID(); parent != spans["createResources"].SpanContext.SpanID() {
+		t.Errorf("createDeploymentCR is not a child of createResources")
+	}
+}
+
+func TestReconcileSpansRecordErrors(t *testing.T) {
+	learn := &devopsv1alpha1.Learn{
+		ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "default", Finalizers: []string{statusFinalizer}},
+	}
+	r := newFakeReconciler(learn)
+	r.Client = &failingCreateClient{Client: r.Client, kind: &appsv1.Deployment{}}
+	exporter := tracetest.NewInMemoryExporter()
+	r.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "broken", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("Reconcile() succeeded, want the Deployment create error")
+	}
+
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "Reconcile", "createResources", "createDeploymentCR":
+			if span.Status.Code != codes.Error {
+				t.Errorf("span %s status = %v, want Error", span.Name, span.Status.Code)
+			}
+		case "createHpaCR":
+			t.Errorf("span %s started after createDeploymentCR failed", span.Name)
+		}
+	}
+}
+
+// failingCreateClient fails every Create of objects of the same type as kind
+type failingCreateClient struct {
+	client.Client
+	kind client.Object
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if reflect.TypeOf(obj) == reflect.TypeOf(c.kind) {
+		return errors.New("create refused")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func spanNames(exporter *tracetest.InMemoryExporter) []string {
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[attribute.Key]string {
+	m := map[attribute.Key]string{}
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value.Emit()
+	}
+	return m
+}
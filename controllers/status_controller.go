@@ -0,0 +1,160 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
+)
+
+// StatusReconciler reconciles a Status object. A Status runs the same app as a
+// Learn, scaled by a HorizontalPodAutoscaler, and reports the status of its
+// Deployment, Service and HorizontalPodAutoscaler.
+type StatusReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Defaults are applied to the fields a Status leaves empty
+	Defaults configv1alpha1.LearnDefaults
+	// MaxConcurrentReconciles is the number of Status objects reconciled in parallel
+	MaxConcurrentReconciles int
+	// ReconcileTimeout bounds a reconcile, DefaultReconcileTimeout is used when zero
+	ReconcileTimeout time.Duration
+}
+
+//+kubebuilder:rbac:groups=devops.dxas90,resources=statuses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=devops.dxas90,resources=statuses/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=devops.dxas90,resources=statuses/finalizers,verbs=update
+
+// Reconcile creates the ConfigMap, ServiceAccount, Deployment, Service and
+// HorizontalPodAutoscaler of a Status, keeps the Deployment image in line with
+// the spec and copies the status of those resources into the Status.
+func (r *StatusReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := withReconcileTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+	reqLogger := log.FromContext(ctx)
+
+	instance := &devopsv1alpha1.Status{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			// The owned resources are garbage collected through their owner references
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if instance.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	setStatusDefaults(instance, r.Defaults)
+	owned := ownedClient{Client: r.Client, scheme: r.Scheme, recorder: r.Recorder}
+	for _, obj := range appResources(instance, r.Scheme) {
+		if err := owned.ensureCreated(ctx, instance, obj); err != nil {
+			reqLogger.Error(err, "Failed to create Status resource", "name", obj.GetName())
+			return ctrl.Result{}, err
+		}
+	}
+	if err := owned.ensureWorkload(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, instance, deployment)
+}
+
+// updateStatus copies the status of the Deployment, Service and, when the
+// Status is autoscaled, HorizontalPodAutoscaler into the Status
+func (r *StatusReconciler) updateStatus(ctx context.Context, instance *devopsv1alpha1.Status, deployment *appsv1.Deployment) error {
+	status := instance.Status.DeepCopy()
+	status.DeploymentStatus = deployment.Status
+	status.Replicas = deployment.Status.Replicas
+	status.LabelSelector = deploymentSelector(deployment)
+	status.CurrentStatus = "OK"
+
+	service := &corev1.Service{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(instance), service); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		status.CurrentStatus = "Service Not Found"
+	}
+	status.ServiceStatus = service.Status
+
+	// A Status with autoscaling disabled has no HorizontalPodAutoscaler to report
+	status.HorizontalPodAutoscalerStatus = nil
+	if instance.AppAutoscaling() != nil {
+		hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(instance), hpa); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			status.CurrentStatus = "HorizontalPodAutoscaler Not Found"
+		} else {
+			status.HorizontalPodAutoscalerStatus = &hpa.Status
+		}
+	}
+
+	if equality.Semantic.DeepEqual(status, &instance.Status) {
+		return nil
+	}
+	instance.Status = *status
+	return r.Status().Update(ctx, instance)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		For(&devopsv1alpha1.Status{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.ServiceAccount{}).
+		Complete(r)
+}
+
+// setStatusDefaults fills the spec fields the user left empty with the operator defaults
+func setStatusDefaults(cr *devopsv1alpha1.Status, defaults configv1alpha1.LearnDefaults) {
+	defaults.Default()
+	if cr.Spec.Replicas <= 0 {
+		cr.Spec.Replicas = defaults.Replicas
+	}
+	if cr.Spec.Image == "" {
+		cr.Spec.Image = defaults.Image
+	}
+	cr.Spec.Autoscaling = defaultAutoscaling(cr.Spec.Autoscaling, defaults)
+}
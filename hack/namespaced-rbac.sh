@@ -0,0 +1,122 @@
+#!/usr/bin/env bash
+# Renders the manager ClusterRole of config/rbac/role.yaml as a Role and a
+# RoleBinding in every namespace the operator watches, plus the patch setting
+# the watched namespaces on the manager, into config/namespaced.
+#
+# The namespaces are read from WATCH_NAMESPACE (comma-separated) and from the
+# namespaces matching WATCH_NAMESPACE_SELECTOR in the current kubectl context.
+# The selector is also passed to the manager, which then needs to list
+# namespaces cluster-wide. The manager restarts to watch the namespaces
+# labelled later, run the script again to give it access to them.
+set -o errexit -o nounset -o pipefail
+
+ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+OUT=${OUT:-${ROOT}/config/namespaced}
+OPERATOR_NAMESPACE=${OPERATOR_NAMESPACE:-learn-operator-system}
+SERVICE_ACCOUNT=${SERVICE_ACCOUNT:-learn-operator-controller-manager}
+WATCH_NAMESPACE=${WATCH_NAMESPACE:-}
+WATCH_NAMESPACE_SELECTOR=${WATCH_NAMESPACE_SELECTOR:-}
+
+namespaces=()
+IFS=',' read -ra listed <<< "${WATCH_NAMESPACE}"
+for ns in "${listed[@]}"; do
+  ns=$(echo "${ns}" | xargs)
+  [[ -n "${ns}" ]] && namespaces+=("${ns}")
+done
+if [[ -n "${WATCH_NAMESPACE_SELECTOR}" ]]; then
+  while read -r ns; do
+    namespaces+=("${ns#namespace/}")
+  done < <(kubectl get namespaces -l "${WATCH_NAMESPACE_SELECTOR}" -o name)
+fi
+if [[ ${#namespaces[@]} -eq 0 ]]; then
+  echo "WATCH_NAMESPACE or WATCH_NAMESPACE_SELECTOR must select at least one namespace" >&2
+  exit 1
+fi
+mapfile -t namespaces < <(printf '%s\n' "${namespaces[@]}" | sort -u)
+
+{
+  echo "# Code generated by hack/namespaced-rbac.sh. DO NOT EDIT."
+  for ns in "${namespaces[@]}"; do
+    # Namespaces are cluster-scoped, a Role cannot grant access to them: the
+    # rule is dropped and the selector gets the ClusterRole below instead
+    sed -e '/^$/d' \
+        -e 's/^kind: ClusterRole$/kind: Role/' \
+        -e '/^  creationTimestamp: null$/d' \
+        -e "s/^  name: manager-role$/  name: learn-operator-manager-role\n  namespace: ${ns}/" \
+        "${ROOT}/config/rbac/role.yaml" |
+      awk '
+        function flush() { if (rule !~ /\n  - namespaces\n/) printf "%s", rule; rule = "" }
+        /^- apiGroups:$/ { flush(); inrule = 1 }
+        !/^[ -]/ { flush(); inrule = 0 }
+        inrule { rule = rule $0 "\n"; next }
+        { print }
+        END { flush() }
+      '
+    cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: learn-operator-manager-rolebinding
+  namespace: ${ns}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: learn-operator-manager-role
+subjects:
+- kind: ServiceAccount
+  name: ${SERVICE_ACCOUNT}
+  namespace: ${OPERATOR_NAMESPACE}
+YAML
+  done
+  if [[ -n "${WATCH_NAMESPACE_SELECTOR}" ]]; then
+    cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: learn-operator-namespace-reader
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - namespaces
+  verbs:
+  - get
+  - list
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: learn-operator-namespace-reader
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: learn-operator-namespace-reader
+subjects:
+- kind: ServiceAccount
+  name: ${SERVICE_ACCOUNT}
+  namespace: ${OPERATOR_NAMESPACE}
+YAML
+  fi
+} > "${OUT}/rbac.yaml"
+
+watch_namespace=$(IFS=','; echo "${listed[*]:-}" | tr -d ' ')
+cat > "${OUT}/manager_watch_namespace_patch.yaml" <<YAML
+# Code generated by hack/namespaced-rbac.sh. DO NOT EDIT.
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: controller-manager
+  namespace: system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        env:
+        - name: WATCH_NAMESPACE
+          value: "${watch_namespace}"
+        - name: WATCH_NAMESPACE_SELECTOR
+          value: "${WATCH_NAMESPACE_SELECTOR}"
+YAML
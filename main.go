@@ -17,21 +17,40 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
 	devopsv1alpha1 "github.com/dxas90/learn-operator/api/v1alpha1"
 	"github.com/dxas90/learn-operator/controllers"
 	//+kubebuilder:scaffold:imports
@@ -46,18 +65,31 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(devopsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var traceSampleRatio float64
+	flag.StringVar(&configFile, "config", "",
+		"The OperatorConfig file the operator settings are loaded from. "+
+			"Flags set on the command line take precedence over its values.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP/HTTP collector the reconcile traces are sent to. "+
+			"Tracing is disabled when empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Send the traces to the OTLP collector over plain HTTP.")
+	flag.Float64Var(&traceSampleRatio, "trace-sample-ratio", 1, "The fraction of reconciles that are traced, between 0 and 1.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -66,33 +98,113 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	watchNamespace, err := getWatchNamespace()
+	shutdownTracing, err := setupTracing(otlpEndpoint, otlpInsecure, traceSampleRatio)
 	if err != nil {
-		setupLog.Error(err, "unable to get WatchNamespace, "+
-			"the manager will watch and manage resources in all namespaces")
-	}
-
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "21a62975.dxas90",
-		Namespace:              watchNamespace, // namespaced-scope when the value is not an empty string
-	})
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	operatorConfig, err := loadOperatorConfig(configFile)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration", "file", configFile)
+		os.Exit(1)
+	}
+
+	options, err := managerOptions(operatorConfig, flag.CommandLine, metricsAddr, probeAddr, enableLeaderElection)
+	if err != nil {
+		setupLog.Error(err, "unable to load the manager options", "file", configFile)
+		os.Exit(1)
+	}
+
+	restConfig := ctrl.GetConfigOrDie()
+	reader, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create the client listing the namespaces")
+		os.Exit(1)
+	}
+	watchNamespaces, watcher, err := getWatchNamespaces(context.Background(), reader, operatorConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to get the namespaces to watch")
+		os.Exit(1)
+	}
+	switch len(watchNamespaces) {
+	case 0:
+		if watcher != nil {
+			// An empty namespace would make the manager watch all of them
+			setupLog.Info("no namespace matches the watch selector yet, the manager waits for one")
+			options.Namespace = ""
+			options.NewCache = cache.MultiNamespacedCacheBuilder(nil)
+		} else if options.Namespace == "" {
+			setupLog.Info("the manager will watch and manage resources in all namespaces")
+		}
+	case 1:
+		options.Namespace = watchNamespaces[0] // namespaced-scope when the value is not an empty string
+	default:
+		options.Namespace = ""
+		options.NewCache = cache.MultiNamespacedCacheBuilder(watchNamespaces)
+	}
+	if len(watchNamespaces) > 0 {
+		setupLog.Info("the manager will watch and manage resources in", "namespaces", watchNamespaces)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	if watcher != nil {
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch the namespaces matching the selector")
+			os.Exit(1)
+		}
+	}
+
+	gatewayAPI, err := controllers.GatewayAPIInstalled(mgr.GetRESTMapper())
+	if err != nil {
+		setupLog.Error(err, "unable to detect the Gateway API")
+		os.Exit(1)
+	}
+	if !gatewayAPI {
+		setupLog.Info("the Gateway API HTTPRoute CRD is not installed, restart the operator once it is to route to the apps with spec.gateway")
+	}
 
 	if err = (&controllers.LearnReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("learn-controller"),
+
+		Defaults:                operatorConfig.LearnDefaults,
+		MaxConcurrentReconciles: operatorConfig.MaxConcurrentReconciles,
+		ReconcileTimeout:        operatorConfig.ReconcileTimeout.Duration,
+		GatewayAPI:              gatewayAPI,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Learn")
 		os.Exit(1)
 	}
+	if err = (&controllers.StatusReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("status-controller"),
+
+		Defaults:                operatorConfig.LearnDefaults,
+		MaxConcurrentReconciles: operatorConfig.MaxConcurrentReconciles,
+		ReconcileTimeout:        operatorConfig.ReconcileTimeout.Duration,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Status")
+		os.Exit(1)
+	}
+	if err = (&controllers.CryptoReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("crypto-controller"),
+
+		Defaults:                operatorConfig.LearnDefaults,
+		MaxConcurrentReconciles: operatorConfig.MaxConcurrentReconciles,
+		ReconcileTimeout:        operatorConfig.ReconcileTimeout.Duration,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Crypto")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -105,22 +217,227 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		setupLog.Error(err, "problem running manager")
+	runErr := mgr.Start(ctrl.SetupSignalHandler())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "unable to flush traces")
+	}
+	if errors.Is(runErr, errWatchNamespacesChanged) {
+		// Restarted by the kubelet with a cache watching the new namespaces
+		os.Exit(0)
+	}
+	if runErr != nil {
+		setupLog.Error(runErr, "problem running manager")
 		os.Exit(1)
 	}
 }
 
-// getWatchNamespace returns the Namespace the operator should be watching for changes
-func getWatchNamespace() (string, error) {
-	// WatchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
-	// which specifies the Namespace to watch.
-	// An empty value means the operator is running with cluster scope.
-	var watchNamespaceEnvVar = "WATCH_NAMESPACE"
+// setupTracing installs a TracerProvider exporting to the OTLP collector at endpoint
+// as the global one, and returns the function flushing it on shutdown. Tracing is
+// left disabled when endpoint is empty.
+func setupTracing(endpoint string, insecure bool, sampleRatio float64) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
 
-	ns, found := os.LookupEnv(watchNamespaceEnvVar)
-	if !found {
-		return "", fmt.Errorf("%s must be set", watchNamespaceEnvVar)
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
 	}
-	return ns, nil
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("learn-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	setupLog.Info("tracing enabled", "endpoint", endpoint, "sampleRatio", sampleRatio)
+	return provider.Shutdown, nil
+}
+
+// loadOperatorConfig reads the OperatorConfig at path, fills the defaults and
+// validates it. The built-in defaults are returned when path is empty.
+func loadOperatorConfig(path string) (*configv1alpha1.OperatorConfig, error) {
+	config := &configv1alpha1.OperatorConfig{}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme, scheme,
+			json.SerializerOptions{Yaml: true, Strict: true})
+		if err := runtime.DecodeInto(decoder, content, config); err != nil {
+			return nil, fmt.Errorf("unable to decode %s: %w", path, err)
+		}
+	}
+	config.Default()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// managerOptions returns the manager options of config. The flags set on the
+// command line of fs take precedence over the file, the default value of the
+// others is used when the file leaves them empty.
+func managerOptions(config *configv1alpha1.OperatorConfig, fs *flag.FlagSet, metricsAddr, probeAddr string, enableLeaderElection bool) (ctrl.Options, error) {
+	options, err := ctrl.Options{Scheme: scheme}.AndFrom(config)
+	if err != nil {
+		return options, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "metrics-bind-address":
+			options.MetricsBindAddress = metricsAddr
+		case "health-probe-bind-address":
+			options.HealthProbeBindAddress = probeAddr
+		case "leader-elect":
+			options.LeaderElection = enableLeaderElection
+		}
+	})
+	if options.MetricsBindAddress == "" {
+		options.MetricsBindAddress = metricsAddr
+	}
+	if options.HealthProbeBindAddress == "" {
+		options.HealthProbeBindAddress = probeAddr
+	}
+	if options.LeaderElectionID == "" {
+		options.LeaderElectionID = "21a62975.dxas90"
+	}
+	if options.Port == 0 {
+		options.Port = 9443
+	}
+	return options, nil
+}
+
+// watchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
+// which specifies the comma-separated list of Namespaces to watch.
+// An empty value means the operator is running with cluster scope.
+const watchNamespaceEnvVar = "WATCH_NAMESPACE"
+
+// watchNamespaceSelectorEnvVar is the constant for env variable
+// WATCH_NAMESPACE_SELECTOR which specifies a label selector of the
+// Namespaces to watch in addition to WATCH_NAMESPACE.
+const watchNamespaceSelectorEnvVar = "WATCH_NAMESPACE_SELECTOR"
+
+// namespaceResyncPeriod is how often the Namespaces matching the watch
+// selector are listed again
+const namespaceResyncPeriod = time.Minute
+
+// errWatchNamespacesChanged stops the manager when the Namespaces matching
+// the watch selector changed, its cache only watches those of the start
+var errWatchNamespacesChanged = errors.New("the namespaces matching the watch selector changed")
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list
+
+// getWatchNamespaces returns the Namespaces the operator should be watching for
+// changes, none means all of them, and the watcher of the Namespaces matching
+// the watch selector, nil when there is no selector. With a selector none means
+// no Namespace at all. The WATCH_NAMESPACE and
+// WATCH_NAMESPACE_SELECTOR environment variables take precedence over the
+// watchNamespaces and watchNamespaceSelector of the configuration file.
+func getWatchNamespaces(ctx context.Context, reader client.Reader, config *configv1alpha1.OperatorConfig) ([]string, *namespaceWatcher, error) {
+	namespaces := config.WatchNamespaces
+	if value := os.Getenv(watchNamespaceEnvVar); value != "" {
+		namespaces = nil
+		for _, ns := range strings.Split(value, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+
+	var selector labels.Selector
+	if config.WatchNamespaceSelector != nil {
+		s, err := metav1.LabelSelectorAsSelector(config.WatchNamespaceSelector)
+		if err != nil {
+			return nil, nil, err
+		}
+		selector = s
+	}
+	if value := os.Getenv(watchNamespaceSelectorEnvVar); value != "" {
+		s, err := labels.Parse(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", watchNamespaceSelectorEnvVar, err)
+		}
+		selector = s
+	}
+	if selector == nil {
+		return namespaces, nil, nil
+	}
+
+	// None may match yet, the watcher restarts the operator when one does
+	watched, err := selectedNamespaces(ctx, reader, namespaces, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	watcher := &namespaceWatcher{
+		reader:     reader,
+		namespaces: namespaces,
+		selector:   selector,
+		watched:    watched,
+		period:     namespaceResyncPeriod,
+	}
+	return watched, watcher, nil
+}
+
+// selectedNamespaces returns the sorted union of namespaces and of the
+// Namespaces matching selector
+func selectedNamespaces(ctx context.Context, reader client.Reader, namespaces []string, selector labels.Selector) ([]string, error) {
+	list := &corev1.NamespaceList{}
+	if err := reader.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("unable to list the namespaces matching %q: %w", selector, err)
+	}
+	watched := sets.NewString(namespaces...)
+	for _, ns := range list.Items {
+		watched.Insert(ns.Name)
+	}
+	return watched.List(), nil
+}
+
+// namespaceWatcher lists the Namespaces matching the watch selector every
+// period and returns errWatchNamespacesChanged once they differ from the
+// watched ones. The cache of the manager cannot add or drop a Namespace, the
+// operator restarts to watch the new set.
+type namespaceWatcher struct {
+	reader     client.Reader
+	namespaces []string
+	selector   labels.Selector
+	watched    []string
+	period     time.Duration
+}
+
+// Start implements manager.Runnable
+func (w *namespaceWatcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := selectedNamespaces(ctx, w.reader, w.namespaces, w.selector)
+		if err != nil {
+			setupLog.Error(err, "unable to check the namespaces to watch")
+			continue
+		}
+		if !reflect.DeepEqual(current, w.watched) {
+			setupLog.Info("the namespaces to watch changed, restarting", "watched", w.watched, "namespaces", current)
+			return errWatchNamespacesChanged
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every
+// replica has its own cache to rebuild
+func (w *namespaceWatcher) NeedLeaderElection() bool {
+	return false
 }
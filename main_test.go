@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	componentconfig "k8s.io/component-base/config/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configv1alpha1 "github.com/dxas90/learn-operator/api/config/v1alpha1"
+)
+
+// writeConfig writes content to a file of a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOperatorConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		path    func(t *testing.T) string
+		wantErr []string
+		check   func(t *testing.T, config *configv1alpha1.OperatorConfig)
+	}{
+		{
+			name: "no file",
+			path: func(t *testing.T) string { return "" },
+			check: func(t *testing.T, config *configv1alpha1.OperatorConfig) {
+				if config.MaxConcurrentReconciles != configv1alpha1.DefaultConcurrentReconciles || config.LearnDefaults.Image != configv1alpha1.DefaultImage {
+					t.Errorf("config = %+v, want the built-in defaults", config)
+				}
+			},
+		},
+		{
+			name: "shipped file",
+			path: func(t *testing.T) string { return "config/manager/controller_manager_config.yaml" },
+			check: func(t *testing.T, config *configv1alpha1.OperatorConfig) {
+				if config.SyncPeriod == nil || config.SyncPeriod.Duration != 10*time.Hour {
+					t.Errorf("syncPeriod = %v, want 10h", config.SyncPeriod)
+				}
+				if config.ReconcileTimeout.Duration != 2*time.Minute || config.LearnDefaults.Replicas != 2 || config.LearnDefaults.MaxReplicas != 5 {
+					t.Errorf("config = %+v, want the values of the file", config)
+				}
+			},
+		},
+		{
+			name: "defaults of the fields the file leaves empty",
+			path: func(t *testing.T) string {
+				return writeConfig(t, "apiVersion: config.devops.dxas90/v1alpha1\nkind: OperatorConfig\nlearnDefaults:\n  replicas: 3\n")
+			},
+			check: func(t *testing.T, config *configv1alpha1.OperatorConfig) {
+				if config.LearnDefaults.Replicas != 3 || config.LearnDefaults.Image != configv1alpha1.DefaultImage || config.ReconcileTimeout.Duration != configv1alpha1.DefaultReconcileTimeout {
+					t.Errorf("config = %+v, want the replicas of the file and the other defaults", config)
+				}
+			},
+		},
+		{
+			name: "unknown field",
+			path: func(t *testing.T) string {
+				return writeConfig(t, "apiVersion: config.devops.dxas90/v1alpha1\nkind: OperatorConfig\nmaxConcurentReconciles: 4\n")
+			},
+			wantErr: []string{"unknown field", "maxConcurentReconciles"},
+		},
+		{
+			name: "invalid values",
+			path: func(t *testing.T) string {
+				return writeConfig(t, `apiVersion: config.devops.dxas90/v1alpha1
+kind: OperatorConfig
+metrics:
+  bindAddress: localhost
+maxConcurrentReconciles: -1
+learnDefaults:
+  image: dxas90/learn
+`)
+			},
+			wantErr: []string{"metrics.bindAddress", "maxConcurrentReconciles", "learnDefaults.image"},
+		},
+		{
+			name:    "missing file",
+			path:    func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing.yaml") },
+			wantErr: []string{"missing.yaml"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := loadOperatorConfig(tt.path(t))
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("loadOperatorConfig() error = nil, want one naming %v", tt.wantErr)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("loadOperatorConfig() error = %v, want it to name %s", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadOperatorConfig() error = %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestOperatorConfigValidate(t *testing.T) {
+	leaderElect := true
+	for _, tt := range []struct {
+		name    string
+		mutate  func(config *configv1alpha1.OperatorConfig)
+		wantErr string
+	}{
+		{"defaults", func(config *configv1alpha1.OperatorConfig) {}, ""},
+		{"disabled metrics", func(config *configv1alpha1.OperatorConfig) { config.Metrics.BindAddress = "0" }, ""},
+		{"sync period", func(config *configv1alpha1.OperatorConfig) {
+			config.SyncPeriod = &metav1.Duration{Duration: -time.Minute}
+		}, "syncPeriod"},
+		{"probe address", func(config *configv1alpha1.OperatorConfig) { config.Health.HealthProbeBindAddress = "8081" }, "health.healthProbeBindAddress"},
+		{"leader election without resource name", func(config *configv1alpha1.OperatorConfig) {
+			config.LeaderElection = &componentconfig.LeaderElectionConfiguration{LeaderElect: &leaderElect}
+		}, "leaderElection.resourceName"},
+		{"namespace", func(config *configv1alpha1.OperatorConfig) { config.WatchNamespaces = []string{"team-a", "Team_B"} }, "watchNamespaces[1]"},
+		{"namespace selector", func(config *configv1alpha1.OperatorConfig) {
+			config.WatchNamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: "Near"}}}
+		}, "watchNamespaceSelector"},
+		{"reconcile timeout", func(config *configv1alpha1.OperatorConfig) {
+			config.ReconcileTimeout = &metav1.Duration{}
+		}, "reconcileTimeout"},
+		{"replicas", func(config *configv1alpha1.OperatorConfig) { config.LearnDefaults.Replicas = -1 }, "learnDefaults.replicas"},
+		{"autoscaler bounds", func(config *configv1alpha1.OperatorConfig) {
+			config.LearnDefaults.MinReplicas, config.LearnDefaults.MaxReplicas = 4, 2
+		}, "learnDefaults.maxReplicas"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &configv1alpha1.OperatorConfig{}
+			config.Default()
+			tt.mutate(config)
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerOptions(t *testing.T) {
+	fileConfig, err := loadOperatorConfig("config/manager/controller_manager_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noConfig, err := loadOperatorConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name            string
+		config          *configv1alpha1.OperatorConfig
+		args            []string
+		wantMetrics     string
+		wantProbe       string
+		wantLeaderElect bool
+	}{
+		{"file", fileConfig, nil, "127.0.0.1:8080", ":8081", true},
+		{"flags over the file", fileConfig, []string{"-metrics-bind-address=:9090", "-leader-elect=false"}, ":9090", ":8081", false},
+		{"flag defaults without a file", noConfig, nil, ":8080", ":8081", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+			metricsAddr := fs.String("metrics-bind-address", ":8080", "")
+			probeAddr := fs.String("health-probe-bind-address", ":8081", "")
+			leaderElect := fs.Bool("leader-elect", false, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			options, err := managerOptions(tt.config, fs, *metricsAddr, *probeAddr, *leaderElect)
+			if err != nil {
+				t.Fatalf("managerOptions() error = %v", err)
+			}
+			if options.MetricsBindAddress != tt.wantMetrics || options.HealthProbeBindAddress != tt.wantProbe || options.LeaderElection != tt.wantLeaderElect {
+				t.Errorf("options = metrics %q, probe %q, leader election %v, want %q, %q, %v",
+					options.MetricsBindAddress, options.HealthProbeBindAddress, options.LeaderElection,
+					tt.wantMetrics, tt.wantProbe, tt.wantLeaderElect)
+			}
+			if options.LeaderElectionID != "21a62975.dxas90" || options.Port != 9443 {
+				t.Errorf("options = leader election ID %q, port %d, want 21a62975.dxas90 and 9443", options.LeaderElectionID, options.Port)
+			}
+		})
+	}
+}
+
+// labelledNamespace returns a Namespace with labels
+func labelledNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestValidateDefaultImage(t *testing.T) {
+	for _, tt := range []struct {
+		image string
+		valid bool
+	}{
+		{"dxas90/learn:1.0.0", true},
+		{"registry:5000/dxas90/learn:1.0.0", true},
+		{"dxas90/learn@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"registry:5000/learn@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"dxas90/learn", false},
+		{"registry:5000/learn", false},
+		{"dxas90/learn:", false},
+		{"dxas90/learn@", false},
+	} {
+		config := &configv1alpha1.OperatorConfig{LearnDefaults: configv1alpha1.LearnDefaults{Image: tt.image}}
+		config.Default()
+		if err := config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() of image %s = %v, want valid %v", tt.image, err, tt.valid)
+		}
+	}
+}
+
+func TestGetWatchNamespaces(t *testing.T) {
+	teamA := map[string]string{"tenant": "team-a"}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		labelledNamespace("team-a-dev", teamA),
+		labelledNamespace("team-a-prod", teamA),
+		labelledNamespace("team-b", map[string]string{"tenant": "team-b"}),
+	).Build()
+
+	for _, tt := range []struct {
+		name        string
+		config      configv1alpha1.OperatorConfig
+		env         map[string]string
+		want        []string
+		wantWatcher bool
+		wantErr     string
+	}{
+		{name: "all namespaces", want: nil},
+		{name: "file", config: configv1alpha1.OperatorConfig{WatchNamespaces: []string{"team-b"}}, want: []string{"team-b"}},
+		{
+			name:   "environment over the file",
+			config: configv1alpha1.OperatorConfig{WatchNamespaces: []string{"team-b"}},
+			env:    map[string]string{watchNamespaceEnvVar: "team-c, team-d,"},
+			want:   []string{"team-c", "team-d"},
+		},
+		{
+			name: "selector of the file",
+			config: configv1alpha1.OperatorConfig{
+				WatchNamespaces:        []string{"team-b"},
+				WatchNamespaceSelector: &metav1.LabelSelector{MatchLabels: teamA},
+			},
+			want:        []string{"team-a-dev", "team-a-prod", "team-b"},
+			wantWatcher: true,
+		},
+		{
+			name:        "selector of the environment over the file",
+			config:      configv1alpha1.OperatorConfig{WatchNamespaceSelector: &metav1.LabelSelector{MatchLabels: teamA}},
+			env:         map[string]string{watchNamespaceSelectorEnvVar: "tenant=team-b"},
+			want:        []string{"team-b"},
+			wantWatcher: true,
+		},
+		{
+			name:    "invalid selector",
+			env:     map[string]string{watchNamespaceSelectorEnvVar: "tenant in team-a"},
+			wantErr: watchNamespaceSelectorEnvVar,
+		},
+		{
+			name:        "no matching namespace",
+			env:         map[string]string{watchNamespaceSelectorEnvVar: "tenant=team-c"},
+			want:        []string{},
+			wantWatcher: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(watchNamespaceEnvVar, tt.env[watchNamespaceEnvVar])
+			t.Setenv(watchNamespaceSelectorEnvVar, tt.env[watchNamespaceSelectorEnvVar])
+
+			got, watcher, err := getWatchNamespaces(context.Background(), reader, &tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("getWatchNamespaces() error = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getWatchNamespaces() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getWatchNamespaces() = %v, want %v", got, tt.want)
+			}
+			if (watcher != nil) != tt.wantWatcher {
+				t.Errorf("getWatchNamespaces() watcher = %v, want one %v", watcher, tt.wantWatcher)
+			}
+		})
+	}
+}
+
+func TestNamespaceWatcher(t *testing.T) {
+	teamA := map[string]string{"tenant": "team-a"}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		labelledNamespace("team-a-dev", teamA),
+		labelledNamespace("team-a-prod", nil),
+	).Build()
+	t.Setenv(watchNamespaceEnvVar, "")
+	t.Setenv(watchNamespaceSelectorEnvVar, "tenant=team-a")
+	_, watcher, err := getWatchNamespaces(context.Background(), reader, &configv1alpha1.OperatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.period = 10 * time.Millisecond
+	if watcher.NeedLeaderElection() {
+		t.Errorf("NeedLeaderElection() = true, want every replica to restart")
+	}
+
+	// Nothing changed, the watcher runs until the manager stops
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := watcher.Start(ctx); err != nil {
+		t.Errorf("Start() error = %v with the same namespaces, want none", err)
+	}
+
+	// A namespace labelled later
+	prod := &corev1.Namespace{}
+	if err := reader.Get(context.Background(), client.ObjectKey{Name: "team-a-prod"}, prod); err != nil {
+		t.Fatal(err)
+	}
+	prod.Labels = teamA
+	if err := reader.Update(context.Background(), prod); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := watcher.Start(ctx); !errors.Is(err, errWatchNamespacesChanged) {
+		t.Errorf("Start() error = %v once a namespace is labelled, want %v", err, errWatchNamespacesChanged)
+	}
+}